@@ -0,0 +1,246 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aluka-7/configuration"
+	"github.com/aluka-7/metacode"
+	"github.com/aluka-7/metric"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+var _metricAuthzDenied = metric.NewCounterVec(&metric.CounterVecOpts{
+	Namespace: serverNamespace,
+	Subsystem: "authz",
+	Name:      "denied_total",
+	Help:      "http server authorization denied count.",
+	Labels:    []string{"path", "permission"},
+})
+
+// Policy 授权策略,权限支持通配符,例如"*"或"order:*".
+//
+//	{
+//	  "roles": {"admin": ["*"], "sales": ["order:read", "order:write"]},
+//	  "subjects": {"tom": ["sales"]},
+//	  "rules": [{"permission": "order:write", "effect": "deny", "when": {"region": "eu"}}]
+//	}
+type Policy struct {
+	Roles    map[string][]string `json:"roles"`    // 角色拥有的权限
+	Subjects map[string][]string `json:"subjects"` // 主体拥有的角色
+	Rules    []PolicyRule        `json:"rules"`    // 基于请求属性的规则
+}
+
+// PolicyRule 基于属性的规则,When中的属性与请求属性全部相等时生效,deny优先于allow.
+// allow规则必须带有When条件,否则等同于将权限授予所有主体.
+type PolicyRule struct {
+	Permission string            `json:"permission"`
+	Effect     string            `json:"effect"` // allow(默认)或deny
+	When       map[string]string `json:"when"`
+}
+
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// Validate 校验策略,未知的effect或没有条件的allow规则返回错误.
+func (p Policy) Validate() error {
+	for i, r := range p.Rules {
+		switch r.Effect {
+		case "", EffectAllow:
+			if len(r.When) == 0 {
+				return fmt.Errorf("rules[%d]: allow规则[%s]缺少when条件", i, r.Permission)
+			}
+		case EffectDeny:
+		default:
+			return fmt.Errorf("rules[%d]: 未知的effect[%s]", i, r.Effect)
+		}
+	}
+	return nil
+}
+
+// Authorizer 授权决策,按主体及角色缓存其拥有的权限,策略更新时清空缓存.
+type Authorizer struct {
+	lock   sync.RWMutex
+	policy Policy
+	cache  map[string][]string
+}
+
+// NewAuthorizer 使用给定策略创建授权决策,策略无效时panic.
+func NewAuthorizer(policy Policy) *Authorizer {
+	a := new(Authorizer)
+	if err := a.SetPolicy(policy); err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// NewAuthorizerFromConfig 从配置中心/system/base/authz/{systemId}加载策略,配置变化时自动更新.
+func NewAuthorizerFromConfig(conf configuration.Configuration, systemId string) *Authorizer {
+	a := NewAuthorizer(Policy{})
+	conf.Get("base", "authz", "", []string{systemId}, a)
+	return a
+}
+
+// Changed 实现configuration.ChangedListener
+func (a *Authorizer) Changed(data map[string]string) {
+	for path, v := range data {
+		var p Policy
+		if err := json.Unmarshal([]byte(v), &p); err != nil {
+			fmt.Printf("更新授权策略[%s]出错:%+v\n", path, err)
+			continue
+		}
+		if err := a.SetPolicy(p); err != nil {
+			fmt.Printf("更新授权策略[%s]出错:%+v\n", path, err)
+		}
+	}
+}
+
+// SetPolicy 替换授权策略,策略无效时返回错误并保留原有策略.
+func (a *Authorizer) SetPolicy(p Policy) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.policy = p
+	a.cache = make(map[string][]string)
+	return nil
+}
+
+// Allowed 判断主体是否拥有权限,roles为主体在令牌等处携带的额外角色,attrs为请求属性.
+func (a *Authorizer) Allowed(subject string, roles []string, attrs map[string]string, permission string) bool {
+	a.lock.RLock()
+	rules := a.policy.Rules
+	a.lock.RUnlock()
+	allowed := false
+	for _, p := range a.permissions(subject, roles) {
+		if matchPermission(p, permission) {
+			allowed = true
+			break
+		}
+	}
+	for _, r := range rules {
+		if !matchPermission(r.Permission, permission) || !matchAttributes(r.When, attrs) {
+			continue
+		}
+		switch r.Effect {
+		case "", EffectAllow:
+			allowed = true
+		default:
+			// deny及未知的effect均拒绝
+			return false
+		}
+	}
+	return allowed
+}
+
+func (a *Authorizer) permissions(subject string, roles []string) []string {
+	roles = append(append([]string(nil), roles...), a.subjectRoles(subject)...)
+	sort.Strings(roles)
+	key := subject + "|" + strings.Join(roles, ",")
+	a.lock.RLock()
+	perms, ok := a.cache[key]
+	a.lock.RUnlock()
+	if ok {
+		return perms
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	perms = []string{}
+	for _, r := range roles {
+		perms = append(perms, a.policy.Roles[r]...)
+	}
+	a.cache[key] = perms
+	return perms
+}
+
+func (a *Authorizer) subjectRoles(subject string) []string {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.policy.Subjects[subject]
+}
+
+func matchPermission(pattern, permission string) bool {
+	if pattern == "*" || pattern == permission {
+		return true
+	}
+	return strings.HasSuffix(pattern, "*") && strings.HasPrefix(permission, pattern[:len(pattern)-1])
+}
+
+func matchAttributes(when, attrs map[string]string) bool {
+	for k, v := range when {
+		if attrs[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Require 声明访问路由所需的全部权限,由AuthorizeWithConfig中间件校验.
+func (s *RouteSpec) Require(permissions ...string) *RouteSpec {
+	s.permissions = append(s.permissions, permissions...)
+	return s.Meta("permissions", s.permissions)
+}
+
+// AuthorizeConfig 授权中间件配置
+type AuthorizeConfig struct {
+	// Skipper defines a function to skip middleware.
+	Skipper middleware.Skipper
+
+	// Authorizer 授权决策,必填
+	Authorizer *Authorizer
+
+	// Roles 返回主体额外携带的角色,例如从JWT声明中读取
+	Roles func(c echo.Context) []string
+
+	// Attributes 返回用于规则匹配的请求属性
+	Attributes func(c echo.Context) map[string]string
+}
+
+// AuthorizeWithConfig 授权中间件,校验当前主体(见SetSubject)是否拥有路由通过Require声明的权限,
+// 未认证时返回metacode.Unauthorized,权限不足时返回metacode.AccessDenied并记录日志和指标.
+func AuthorizeWithConfig(config AuthorizeConfig) echo.MiddlewareFunc {
+	if config.Authorizer == nil {
+		panic("authorizer is required")
+	}
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+			spec := lookupRouteSpec(c.Echo(), c.Request().Method, c.Path())
+			if spec == nil || len(spec.permissions) == 0 {
+				return next(c)
+			}
+			subject := Subject(c)
+			if len(subject) == 0 {
+				return metacode.Errorf(metacode.Unauthorized, "未认证")
+			}
+			var roles []string
+			if config.Roles != nil {
+				roles = config.Roles(c)
+			}
+			var attrs map[string]string
+			if config.Attributes != nil {
+				attrs = config.Attributes(c)
+			}
+			for _, p := range spec.permissions {
+				if !config.Authorizer.Allowed(subject, roles, attrs, p) {
+					_metricAuthzDenied.Inc(c.Path(), p)
+					c.Logger().Warnf("拒绝访问:subject=%s route=%s %s permission=%s", subject, c.Request().Method, c.Path(), p)
+					return metacode.Errorf(metacode.AccessDenied, "缺少权限[%s]", p)
+				}
+			}
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package web_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aluka-7/web"
+	"github.com/labstack/echo/v4"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAuthorize(t *testing.T) {
+	Convey("test Authorize middleware\n", t, func() {
+		authz := web.NewAuthorizer(web.Policy{
+			Roles:    map[string][]string{"admin": {"*"}, "sales": {"order:read", "order:write"}, "viewer": {"order:read"}},
+			Subjects: map[string][]string{"tom": {"sales"}, "root": {"admin"}},
+			Rules:    []web.PolicyRule{{Permission: "order:write", Effect: "deny", When: map[string]string{"region": "eu"}}},
+		})
+		e := echo.New()
+		e.HTTPErrorHandler = web.HTTPErrorHandler
+		e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error {
+				web.SetSubject(c, c.Request().Header.Get("X-User"))
+				return next(c)
+			}
+		})
+		e.Use(web.AuthorizeWithConfig(web.AuthorizeConfig{
+			Authorizer: authz,
+			Roles: func(c echo.Context) []string {
+				if r := c.Request().Header.Get("X-Role"); r != "" {
+					return []string{r}
+				}
+				return nil
+			},
+			Attributes: func(c echo.Context) map[string]string {
+				return map[string]string{"region": c.QueryParam("region")}
+			},
+		}))
+		ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+		web.Describe(e, e.GET("/orders", ok)).Require("order:read")
+		web.Describe(e, e.POST("/orders", ok)).Require("order:write")
+		e.GET("/public", ok)
+		do := func(method, path, user, role string) int {
+			req := httptest.NewRequest(method, path, nil)
+			req.Header.Set("X-User", user)
+			req.Header.Set("X-Role", role)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			return rec.Code
+		}
+
+		So(do(http.MethodGet, "/public", "", ""), ShouldEqual, http.StatusOK)
+		So(do(http.MethodGet, "/orders", "", ""), ShouldEqual, http.StatusUnauthorized)
+		So(do(http.MethodGet, "/orders", "tom", ""), ShouldEqual, http.StatusOK)
+		So(do(http.MethodPost, "/orders", "tom", ""), ShouldEqual, http.StatusOK)
+		So(do(http.MethodPost, "/orders?region=eu", "tom", ""), ShouldEqual, http.StatusForbidden)
+		So(do(http.MethodPost, "/orders", "jack", ""), ShouldEqual, http.StatusForbidden)
+		So(do(http.MethodGet, "/orders", "jack", "viewer"), ShouldEqual, http.StatusOK)
+		So(do(http.MethodPost, "/orders", "root", ""), ShouldEqual, http.StatusOK)
+
+		// 策略热更新后缓存失效
+		authz.Changed(map[string]string{"/system/base/authz/test": `{"roles":{"sales":["order:read"]},"subjects":{"tom":["sales"]}}`})
+		So(do(http.MethodPost, "/orders", "tom", ""), ShouldEqual, http.StatusForbidden)
+		So(do(http.MethodGet, "/orders", "tom", ""), ShouldEqual, http.StatusOK)
+
+		// 无效的策略不生效
+		authz.Changed(map[string]string{"/system/base/authz/test": `{"rules":[{"permission":"*","effect":"alow","when":{"region":"eu"}}]}`})
+		authz.Changed(map[string]string{"/system/base/authz/test": `{"rules":[{"permission":"*"}]}`})
+		So(do(http.MethodPost, "/orders", "tom", ""), ShouldEqual, http.StatusForbidden)
+		So(do(http.MethodGet, "/orders", "tom", ""), ShouldEqual, http.StatusOK)
+	})
+}
+
+func TestPolicyValidate(t *testing.T) {
+	Convey("test Policy validation\n", t, func() {
+		rule := func(effect string, when map[string]string) web.Policy {
+			return web.Policy{Rules: []web.PolicyRule{{Permission: "order:write", Effect: effect, When: when}}}
+		}
+		region := map[string]string{"region": "us"}
+		So(rule("", region).Validate(), ShouldBeNil)
+		So(rule(web.EffectAllow, region).Validate(), ShouldBeNil)
+		So(rule(web.EffectDeny, nil).Validate(), ShouldBeNil)
+		So(rule("Deny", region).Validate(), ShouldNotBeNil)
+		So(rule("block", region).Validate(), ShouldNotBeNil)
+		So(rule(web.EffectAllow, nil).Validate(), ShouldNotBeNil)
+		So(func() { web.NewAuthorizer(rule("alow", region)) }, ShouldPanic)
+
+		// 条件匹配的allow规则授予权限
+		authz := web.NewAuthorizer(rule(web.EffectAllow, region))
+		So(authz.Allowed("jack", nil, region, "order:write"), ShouldBeTrue)
+		So(authz.Allowed("jack", nil, map[string]string{"region": "eu"}, "order:write"), ShouldBeFalse)
+		So(authz.Allowed("jack", nil, nil, "order:write"), ShouldBeFalse)
+	})
+}
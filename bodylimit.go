@@ -0,0 +1,84 @@
+package web
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/bytes"
+)
+
+// BodyLimitConfig 请求体大小限制,大小格式如"4M","512KB"
+type BodyLimitConfig struct {
+	Limit  string            `json:"limit"`  // 全局限制,为空时不限制
+	Routes map[string]string `json:"routes"` // 路由级限制,键为"METHOD /path"或"/path",路径与注册路由时一致,优先于全局限制
+}
+
+// BodyLimit 声明路由的请求体大小限制,优先于全局限制,配置中的路由级限制优先于此处的声明.
+func (s *RouteSpec) BodyLimit(limit string) *RouteSpec {
+	s.bodyLimit = parseBodyLimit(limit)
+	return s.Meta("bodyLimit", limit)
+}
+
+// BodyLimitWithConfig 请求体大小限制中间件,Content-Length或实际读取的字节数超过限制时返回413.
+func BodyLimitWithConfig(config BodyLimitConfig) echo.MiddlewareFunc {
+	global := parseBodyLimit(config.Limit)
+	routes := make(map[string]int64, len(config.Routes))
+	for k, v := range config.Routes {
+		routes[k] = parseBodyLimit(v)
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			limit, ok := routes[req.Method+" "+c.Path()]
+			if !ok {
+				limit, ok = routes[c.Path()]
+			}
+			if !ok {
+				if s := lookupRouteSpec(c.Echo(), req.Method, c.Path()); s != nil && s.bodyLimit > 0 {
+					limit, ok = s.bodyLimit, true
+				}
+			}
+			if !ok {
+				limit = global
+			}
+			if limit <= 0 {
+				return next(c)
+			}
+			if req.ContentLength > limit {
+				return echo.ErrStatusRequestEntityTooLarge
+			}
+			req.Body = &limitedBody{ReadCloser: req.Body, limit: limit}
+			return next(c)
+		}
+	}
+}
+
+func parseBodyLimit(limit string) int64 {
+	if len(limit) == 0 {
+		return 0
+	}
+	n, err := bytes.Parse(limit)
+	if err != nil {
+		panic(fmt.Errorf("invalid body limit %q", limit))
+	}
+	return n
+}
+
+type limitedBody struct {
+	io.ReadCloser
+	limit, read int64
+}
+
+func (r *limitedBody) Read(b []byte) (n int, err error) {
+	n, err = r.ReadCloser.Read(b)
+	r.read += int64(n)
+	if r.exceeded() {
+		return n, echo.ErrStatusRequestEntityTooLarge
+	}
+	return
+}
+
+func (r *limitedBody) exceeded() bool {
+	return r.read > r.limit
+}
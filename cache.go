@@ -0,0 +1,346 @@
+package web
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aluka-7/trace"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const HeaderXCache = "X-Cache"
+
+// 只属于单次请求或单个连接的响应头,不能随缓存或重放的响应返回给其他请求
+var perRequestHeaders = []string{
+	echo.HeaderXRequestID, trace.SystemTraceID, echo.HeaderSetCookie,
+	echo.HeaderContentSecurityPolicy, echo.HeaderContentSecurityPolicyReportOnly,
+	"Connection", "Keep-Alive", "Transfer-Encoding", "Date", "Age", HeaderXCache,
+}
+
+func stripPerRequestHeaders(h http.Header) {
+	for _, k := range perRequestHeaders {
+		h.Del(k)
+	}
+}
+
+// CacheEntry 缓存的响应
+type CacheEntry struct {
+	Status       int
+	Header       http.Header
+	Body         []byte
+	ETag         string
+	LastModified time.Time
+	Created      time.Time
+	Expires      time.Time // 在此之前为新鲜
+	StaleUntil   time.Time // 过期后在此之前仍可先返回旧响应并在后台刷新
+}
+
+// CacheStore 响应缓存存储
+type CacheStore interface {
+	Get(key string) (*CacheEntry, bool)
+	Set(key string, e *CacheEntry)
+	Delete(key string)
+}
+
+// CacheConfig 响应缓存中间件配置
+type CacheConfig struct {
+	// Skipper defines a function to skip middleware.
+	Skipper middleware.Skipper
+
+	// Store 缓存存储,默认为容量1000的LRU
+	Store CacheStore
+
+	// TTL 响应新鲜的时间,默认1分钟
+	TTL time.Duration
+
+	// StaleWhileRevalidate 过期后仍可返回旧响应的时间,期间在后台重新生成,为0时不启用.
+	// 后台刷新的上下文不包含外层中间件通过c.Set设置的主体,会话等,携带凭证的请求过期后总是同步重新生成.
+	StaleWhileRevalidate time.Duration
+
+	// VaryHeaders 参与缓存键的请求头,例如Accept,Accept-Language
+	VaryHeaders []string
+
+	// WeakETag 生成弱ETag(W/"...")
+	WeakETag bool
+
+	// AllowCredentials 缓存携带Authorization或Cookie的请求,缓存键包含认证主体(见Subject),需注册在认证中间件之后.
+	// 默认不缓存这类请求,避免将一个用户的响应返回给其他用户.
+	AllowCredentials bool
+}
+
+// CacheWithConfig 响应缓存中间件,缓存GET请求状态码为200的响应,缓存键由路由,请求路径,排序后的查询参数及VaryHeaders组成.
+// 自动生成ETag及Last-Modified并处理If-None-Match和If-Modified-Since条件请求.
+// 响应包含Set-Cookie或Cache-Control为no-store,private时不缓存,请求携带Authorization或Cookie时默认不缓存.
+func CacheWithConfig(config CacheConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	if config.Store == nil {
+		config.Store = NewLRUCacheStore(1000)
+	}
+	if config.TTL == 0 {
+		config.TTL = time.Minute
+	}
+	var revalidating sync.Map
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if req.Method != http.MethodGet || config.Skipper(c) {
+				return next(c)
+			}
+			credentialed := len(req.Header.Get(echo.HeaderAuthorization)) > 0 || len(req.Header.Get(echo.HeaderCookie)) > 0
+			if credentialed && !config.AllowCredentials {
+				return next(c)
+			}
+			key := config.key(c)
+			now := time.Now()
+			if e, ok := config.Store.Get(key); ok {
+				if now.Before(e.Expires) {
+					_metricServerCacheTotal.Inc(c.Path(), "hit")
+					return serveCacheEntry(c, e, "HIT")
+				}
+				if now.Before(e.StaleUntil) && !credentialed {
+					_metricServerCacheTotal.Inc(c.Path(), "stale")
+					// 原请求结束后上下文会被取消,后台刷新使用独立的上下文
+					if _, loaded := revalidating.LoadOrStore(key, struct{}{}); !loaded {
+						bg := c.Echo().NewContext(c.Request().Clone(context.Background()), newCaptureWriter())
+						bg.SetPath(c.Path())
+						bg.SetParamNames(c.ParamNames()...)
+						bg.SetParamValues(c.ParamValues()...)
+						go func() {
+							defer revalidating.Delete(key)
+							config.revalidate(bg, next, key)
+						}()
+					}
+					return serveCacheEntry(c, e, "STALE")
+				}
+			}
+			_metricServerCacheTotal.Inc(c.Path(), "miss")
+
+			res := c.Response()
+			dump := &bodyDumpWriter{ResponseWriter: res.Writer, buffered: true}
+			res.Writer = dump
+			err := next(c)
+			res.Writer = dump.ResponseWriter
+			if err != nil {
+				res.Committed, res.Size = false, 0
+				return err
+			}
+			// 使用了本次请求CSP nonce的页面不能返回给其他请求
+			if nonce := CSPNonce(c); len(nonce) > 0 && bytes.Contains(dump.body.Bytes(), []byte(nonce)) {
+				return dump.flush()
+			}
+			if e := config.entry(res.Status, res.Header(), dump.body.Bytes(), now); e != nil {
+				config.Store.Set(key, e)
+				res.Header().Set(HeaderXCache, "MISS")
+				if notModified(c.Request(), e) {
+					res.Status = http.StatusNotModified
+					dump.ResponseWriter.WriteHeader(http.StatusNotModified)
+					return nil
+				}
+			}
+			return dump.flush()
+		}
+	}
+}
+
+// 后台重新生成响应,失败时保留旧缓存直到StaleUntil
+func (config CacheConfig) revalidate(c echo.Context, next echo.HandlerFunc, key string) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.Logger().Errorf("刷新缓存出错:%v", r)
+		}
+	}()
+	if err := next(c); err != nil {
+		c.Logger().Warnf("刷新缓存出错:%+v", err)
+		return
+	}
+	w := c.Response().Writer.(*captureWriter)
+	if e := config.entry(c.Response().Status, w.header, w.body.Bytes(), time.Now()); e != nil {
+		config.Store.Set(key, e)
+	}
+}
+
+func (config CacheConfig) key(c echo.Context) string {
+	req := c.Request()
+	var b strings.Builder
+	b.WriteString(c.Path())
+	b.WriteByte(' ')
+	b.WriteString(req.URL.Path)
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	sep := byte('?')
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			b.WriteByte(sep)
+			sep = '&'
+			b.WriteString(url.QueryEscape(k) + "=" + url.QueryEscape(v))
+		}
+	}
+	// 全局压缩中间件在缓存之内时缓存的是压缩后的内容
+	b.WriteString("\nAccept-Encoding:" + req.Header.Get(echo.HeaderAcceptEncoding))
+	for _, h := range config.VaryHeaders {
+		b.WriteString("\n" + h + ":" + req.Header.Get(h))
+	}
+	if config.AllowCredentials {
+		b.WriteString("\nsubject:" + Subject(c))
+	}
+	return b.String()
+}
+
+// 根据响应生成缓存条目,不可缓存时返回nil
+func (config CacheConfig) entry(status int, header http.Header, body []byte, now time.Time) *CacheEntry {
+	if status != http.StatusOK || len(header.Values(echo.HeaderSetCookie)) > 0 {
+		return nil
+	}
+	cc := strings.ToLower(header.Get("Cache-Control"))
+	if strings.Contains(cc, "no-store") || strings.Contains(cc, "private") {
+		return nil
+	}
+	etag := header.Get("ETag")
+	if len(etag) == 0 {
+		sum := sha256.Sum256(body)
+		etag = `"` + hex.EncodeToString(sum[:16]) + `"`
+		if config.WeakETag {
+			etag = "W/" + etag
+		}
+		header.Set("ETag", etag)
+	}
+	modified, err := http.ParseTime(header.Get(echo.HeaderLastModified))
+	if err != nil {
+		modified = now.UTC().Truncate(time.Second)
+		header.Set(echo.HeaderLastModified, modified.Format(http.TimeFormat))
+	}
+	stored := header.Clone()
+	stripPerRequestHeaders(stored)
+	return &CacheEntry{
+		Status:       status,
+		Header:       stored,
+		Body:         append([]byte(nil), body...),
+		ETag:         etag,
+		LastModified: modified,
+		Created:      now,
+		Expires:      now.Add(config.TTL),
+		StaleUntil:   now.Add(config.TTL + config.StaleWhileRevalidate),
+	}
+}
+
+func serveCacheEntry(c echo.Context, e *CacheEntry, result string) error {
+	h := c.Response().Header()
+	for k, v := range e.Header {
+		h[k] = append([]string(nil), v...)
+	}
+	h.Set(HeaderXCache, result)
+	h.Set("Age", strconv.Itoa(int(time.Since(e.Created)/time.Second)))
+	if notModified(c.Request(), e) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	return c.Blob(e.Status, e.Header.Get(echo.HeaderContentType), e.Body)
+}
+
+// 条件请求判断,If-None-Match优先于If-Modified-Since,ETag使用弱比较
+func notModified(req *http.Request, e *CacheEntry) bool {
+	if inm := req.Header.Get("If-None-Match"); len(inm) > 0 {
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(e.ETag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	if ims, err := http.ParseTime(req.Header.Get("If-Modified-Since")); err == nil {
+		return !e.LastModified.After(ims)
+	}
+	return false
+}
+
+// 后台刷新时使用的响应,只记录不写出
+type captureWriter struct {
+	header http.Header
+	body   bytes.Buffer
+}
+
+func newCaptureWriter() *captureWriter {
+	return &captureWriter{header: make(http.Header)}
+}
+
+func (w *captureWriter) Header() http.Header         { return w.header }
+func (w *captureWriter) WriteHeader(int)             {}
+func (w *captureWriter) Write(b []byte) (int, error) { return w.body.Write(b) }
+
+// NewLRUCacheStore 创建最多保存capacity条响应的进程内LRU缓存
+func NewLRUCacheStore(capacity int) CacheStore {
+	return &lruCacheStore{capacity: capacity, items: make(map[string]*list.Element), order: list.New()}
+}
+
+type lruCacheStore struct {
+	lock     sync.Mutex
+	capacity int
+	items    map[string]*list.Element
+	order    *list.List // 最近使用的在前
+}
+
+type lruItem struct {
+	key   string
+	entry *CacheEntry
+}
+
+func (s *lruCacheStore) Get(key string) (*CacheEntry, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	el, ok := s.items[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*lruItem).entry
+	if time.Now().After(e.StaleUntil) {
+		s.order.Remove(el)
+		delete(s.items, key)
+		return nil, false
+	}
+	s.order.MoveToFront(el)
+	return e, true
+}
+
+func (s *lruCacheStore) Set(key string, e *CacheEntry) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if el, ok := s.items[key]; ok {
+		el.Value.(*lruItem).entry = e
+		s.order.MoveToFront(el)
+		return
+	}
+	s.items[key] = s.order.PushFront(&lruItem{key: key, entry: e})
+	for s.order.Len() > s.capacity {
+		last := s.order.Back()
+		s.order.Remove(last)
+		delete(s.items, last.Value.(*lruItem).key)
+	}
+}
+
+func (s *lruCacheStore) Delete(key string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if el, ok := s.items[key]; ok {
+		s.order.Remove(el)
+		delete(s.items, key)
+	}
+}
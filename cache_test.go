@@ -0,0 +1,177 @@
+package web_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aluka-7/web"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCache(t *testing.T) {
+	Convey("test Cache middleware\n", t, func() {
+		var calls int32
+		e := echo.New()
+		cache := web.CacheWithConfig(web.CacheConfig{
+			TTL:                  100 * time.Millisecond,
+			StaleWhileRevalidate: time.Second,
+			VaryHeaders:          []string{"Accept-Language"},
+		})
+		e.GET("/items/:id", func(c echo.Context) error {
+			n := atomic.AddInt32(&calls, 1)
+			return c.String(http.StatusOK, c.Param("id")+":"+strconv.Itoa(int(n))+":"+c.Request().Header.Get("Accept-Language"))
+		}, cache)
+		e.GET("/private", func(c echo.Context) error {
+			atomic.AddInt32(&calls, 1)
+			c.Response().Header().Set("Cache-Control", "private")
+			return c.String(http.StatusOK, "secret")
+		}, cache)
+		do := func(target string, header ...string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, target, nil)
+			for i := 0; i < len(header); i += 2 {
+				req.Header.Set(header[i], header[i+1])
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			return rec
+		}
+
+		rec := do("/items/1?b=2&a=1")
+		So(rec.Body.String(), ShouldEqual, "1:1:")
+		So(rec.Header().Get(web.HeaderXCache), ShouldEqual, "MISS")
+		etag := rec.Header().Get("ETag")
+		So(etag, ShouldStartWith, `"`)
+		lastModified := rec.Header().Get(echo.HeaderLastModified)
+		So(lastModified, ShouldNotBeEmpty)
+
+		// 查询参数顺序不影响缓存键
+		rec = do("/items/1?a=1&b=2")
+		So(rec.Body.String(), ShouldEqual, "1:1:")
+		So(rec.Header().Get(web.HeaderXCache), ShouldEqual, "HIT")
+		So(rec.Header().Get("ETag"), ShouldEqual, etag)
+		So(do("/items/2").Body.String(), ShouldEqual, "2:2:")
+		So(do("/items/1?a=1&b=2", "Accept-Language", "zh").Body.String(), ShouldEqual, "1:3:zh")
+
+		// 条件请求
+		So(do("/items/1?a=1&b=2", "If-None-Match", "W/"+etag).Code, ShouldEqual, http.StatusNotModified)
+		So(do("/items/1?a=1&b=2", "If-None-Match", `"other"`).Code, ShouldEqual, http.StatusOK)
+		So(do("/items/1?a=1&b=2", "If-Modified-Since", lastModified).Code, ShouldEqual, http.StatusNotModified)
+		So(do("/items/3", "If-None-Match", "*").Code, ShouldEqual, http.StatusNotModified)
+
+		// 过期后先返回旧响应,后台刷新
+		time.Sleep(150 * time.Millisecond)
+		rec = do("/items/1?a=1&b=2")
+		So(rec.Header().Get(web.HeaderXCache), ShouldEqual, "STALE")
+		So(rec.Body.String(), ShouldEqual, "1:1:")
+		time.Sleep(50 * time.Millisecond)
+		rec = do("/items/1?a=1&b=2")
+		So(rec.Header().Get(web.HeaderXCache), ShouldEqual, "HIT")
+		So(rec.Body.String(), ShouldEqual, "1:5:")
+
+		// 不可缓存的响应
+		n := atomic.LoadInt32(&calls)
+		do("/private")
+		do("/private")
+		So(atomic.LoadInt32(&calls), ShouldEqual, n+2)
+
+		// 携带凭证的请求默认不缓存
+		n = atomic.LoadInt32(&calls)
+		So(do("/items/9", "Authorization", "Bearer a").Header().Get(web.HeaderXCache), ShouldBeEmpty)
+		So(do("/items/9", "Cookie", "sid=b").Header().Get(web.HeaderXCache), ShouldBeEmpty)
+		So(atomic.LoadInt32(&calls), ShouldEqual, n+2)
+	})
+}
+
+func TestCacheHeaders(t *testing.T) {
+	Convey("test Cache per-request headers and encoding\n", t, func() {
+		var id int32
+		e := echo.New()
+		e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error {
+				c.Response().Header().Set(echo.HeaderXRequestID, strconv.Itoa(int(atomic.AddInt32(&id, 1))))
+				return next(c)
+			}
+		})
+		e.Use(web.SecureWithConfig(web.SecureConfig{ContentSecurityPolicy: "script-src {nonce}"}))
+		e.Use(web.CacheWithConfig(web.CacheConfig{}))
+		e.Use(middleware.Gzip())
+		e.GET("/data", func(c echo.Context) error {
+			return c.String(http.StatusOK, strings.Repeat("data", 100))
+		})
+		e.GET("/page", func(c echo.Context) error {
+			return c.HTML(http.StatusOK, `<script nonce="`+web.CSPNonce(c)+`"></script>`)
+		})
+		do := func(target string, header ...string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, target, nil)
+			for i := 0; i < len(header); i += 2 {
+				req.Header.Set(header[i], header[i+1])
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			return rec
+		}
+
+		first := do("/data", "Accept-Encoding", "gzip")
+		So(first.Header().Get(echo.HeaderContentEncoding), ShouldEqual, "gzip")
+		rec := do("/data", "Accept-Encoding", "gzip")
+		So(rec.Header().Get(web.HeaderXCache), ShouldEqual, "HIT")
+		So(rec.Header().Get(echo.HeaderXRequestID), ShouldNotEqual, first.Header().Get(echo.HeaderXRequestID))
+		So(rec.Header().Get(echo.HeaderContentSecurityPolicy), ShouldNotEqual, first.Header().Get(echo.HeaderContentSecurityPolicy))
+
+		// 不接受gzip的客户端不会拿到压缩的内容
+		rec = do("/data")
+		So(rec.Header().Get(web.HeaderXCache), ShouldEqual, "MISS")
+		So(rec.Header().Get(echo.HeaderContentEncoding), ShouldBeEmpty)
+		So(rec.Body.String(), ShouldStartWith, "datadata")
+
+		// 包含nonce的页面不缓存
+		do("/page")
+		So(do("/page").Header().Get(web.HeaderXCache), ShouldBeEmpty)
+	})
+}
+
+func TestCacheCredentials(t *testing.T) {
+	Convey("test Cache keyed by subject\n", t, func() {
+		e := echo.New()
+		e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error {
+				web.SetSubject(c, c.Request().Header.Get("Authorization"))
+				return next(c)
+			}
+		})
+		e.GET("/me", func(c echo.Context) error {
+			return c.String(http.StatusOK, web.Subject(c))
+		}, web.CacheWithConfig(web.CacheConfig{AllowCredentials: true, TTL: 50 * time.Millisecond, StaleWhileRevalidate: time.Second}))
+		do := func(user string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, "/me", nil)
+			req.Header.Set("Authorization", user)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			return rec
+		}
+		So(do("tom").Body.String(), ShouldEqual, "tom")
+		rec := do("jerry")
+		So(rec.Body.String(), ShouldEqual, "jerry")
+		So(rec.Header().Get(web.HeaderXCache), ShouldEqual, "MISS")
+		rec = do("tom")
+		So(rec.Body.String(), ShouldEqual, "tom")
+		So(rec.Header().Get(web.HeaderXCache), ShouldEqual, "HIT")
+
+		// 过期后不在丢失主体的后台上下文中刷新,而是同步重新生成
+		time.Sleep(80 * time.Millisecond)
+		rec = do("tom")
+		So(rec.Body.String(), ShouldEqual, "tom")
+		So(rec.Header().Get(web.HeaderXCache), ShouldEqual, "MISS")
+		time.Sleep(20 * time.Millisecond)
+		rec = do("tom")
+		So(rec.Body.String(), ShouldEqual, "tom")
+		So(rec.Header().Get(web.HeaderXCache), ShouldEqual, "HIT")
+	})
+}
@@ -0,0 +1,163 @@
+package web
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	docRouteName   = "web.doc"
+	defaultDocPath = "/doc"
+)
+
+// 页面模板及内嵌的Swagger UI,ReDoc前端资源,资源由fetch-assets.sh下载(go generate),不依赖外网CDN.
+//
+//go:generate sh docui/fetch-assets.sh
+//go:embed docui/*.html docui/assets
+var docUI embed.FS
+
+var docTemplates = template.Must(template.ParseFS(docUI, "docui/*.html"))
+
+// RegisterDoc 注册接口文档:
+//
+//	{path}/openapi.json(或openapi.yaml) OpenAPI文档
+//	{path}/swagger                      Swagger UI
+//	{path}/redoc                        ReDoc
+//	{path}/assets/*                     内嵌的前端资源
+//
+// spec为nil时优先使用conf.Spec指定的文件,否则根据已注册的路由生成文档.
+// 页面不使用内联脚本,前端资源默认使用内嵌的版本,可通过DocConfig.SwaggerUI及DocConfig.Redoc指向其他地址.
+func RegisterDoc(eng *echo.Echo, conf DocConfig, info OpenAPIInfo, spec echo.HandlerFunc) {
+	if len(conf.Path) == 0 {
+		conf.Path = defaultDocPath
+	}
+	conf.Path = strings.TrimSuffix(conf.Path, "/")
+	assets := docAssets(conf.Path + "/assets")
+	specPath := conf.Path + "/openapi.json"
+	if spec == nil {
+		if len(conf.Spec) > 0 {
+			spec, specPath = specFileHandler(conf)
+		} else {
+			spec = OpenAPIHandler(info)
+		}
+	}
+	swaggerJS, swaggerCSS := assets.URL("swagger-ui/swagger-ui-bundle.js"), assets.URL("swagger-ui/swagger-ui.css")
+	if len(conf.SwaggerUI) > 0 {
+		base := strings.TrimSuffix(conf.SwaggerUI, "/")
+		swaggerJS, swaggerCSS = base+"/swagger-ui-bundle.js", base+"/swagger-ui.css"
+	}
+	redoc := conf.Redoc
+	if _, ok := assets.files["redoc/redoc.standalone.js"]; ok && len(redoc) == 0 {
+		redoc = assets.URL("redoc/redoc.standalone.js")
+	}
+	page := map[string]interface{}{
+		"Title":       info.Title,
+		"Spec":        specPath,
+		"SwaggerJS":   swaggerJS,
+		"SwaggerCSS":  swaggerCSS,
+		"SwaggerInit": assets.URL("swagger-init.js"),
+		"Redoc":       redoc,
+	}
+	g := eng.Group(conf.Path, docAccess(conf)...)
+	g.GET(strings.TrimPrefix(specPath, conf.Path), spec).Name = docRouteName
+	g.GET("/assets/*", func(c echo.Context) error {
+		f, ok := assets.files[path.Clean(c.Param("*"))]
+		if !ok {
+			return echo.ErrNotFound
+		}
+		return assets.serve(c, f, assetCacheControl(f, 0))
+	}).Name = docRouteName
+	g.GET("/swagger", docPage("swagger.html", page)).Name = docRouteName
+	if len(redoc) == 0 {
+		fmt.Println("未内嵌ReDoc资源且未配置DocConfig.Redoc,不注册ReDoc页面,执行go generate下载资源")
+		return
+	}
+	g.GET("/redoc", docPage("redoc.html", page)).Name = docRouteName
+}
+
+// 匹配接口文档的路由:内嵌资源已预压缩,SwagHandler自行输出响应,都不再经过全局压缩
+func docRouteSkipper(conf DocConfig, swag bool) middleware.Skipper {
+	prefix := strings.TrimSuffix(conf.Path, "/")
+	if len(prefix) == 0 {
+		prefix = defaultDocPath
+	}
+	return func(c echo.Context) bool {
+		p := c.Path()
+		return (swag && p == defaultDocPath+"/*") || (conf.Enable && strings.HasPrefix(p, prefix+"/"))
+	}
+}
+
+// 内嵌的前端资源,prefix为访问路径前缀
+func docAssets(prefix string) *Assets {
+	sub, err := fs.Sub(docUI, "docui/assets")
+	if err != nil {
+		panic("加载接口文档资源出错:" + err.Error())
+	}
+	assets, err := NewAssets(sub, prefix)
+	if err != nil {
+		panic("加载接口文档资源出错:" + err.Error())
+	}
+	return assets
+}
+
+// 读取外部OpenAPI文档文件,启动时文件不存在直接panic
+func specFileHandler(conf DocConfig) (echo.HandlerFunc, string) {
+	data, err := ioutil.ReadFile(conf.Spec)
+	if err != nil {
+		panic("读取OpenAPI文档出错:" + err.Error())
+	}
+	path, contentType := conf.Path+"/openapi.json", echo.MIMEApplicationJSONCharsetUTF8
+	if ext := filepath.Ext(conf.Spec); ext == ".yaml" || ext == ".yml" {
+		path, contentType = conf.Path+"/openapi.yaml", "application/yaml; charset=UTF-8"
+	}
+	return func(c echo.Context) error {
+		return c.Blob(http.StatusOK, contentType, data)
+	}, path
+}
+
+func docPage(name string, data interface{}) echo.HandlerFunc {
+	buf := new(bytes.Buffer)
+	if err := docTemplates.ExecuteTemplate(buf, name, data); err != nil {
+		panic("渲染接口文档页面出错:" + err.Error())
+	}
+	html := buf.Bytes()
+	return func(c echo.Context) error {
+		return c.HTMLBlob(http.StatusOK, html)
+	}
+}
+
+// 接口文档的访问控制:IP白名单和Basic认证
+func docAccess(conf DocConfig) []echo.MiddlewareFunc {
+	var m []echo.MiddlewareFunc
+	if len(conf.AllowIPs) > 0 {
+		nets := parseCIDRs(conf.AllowIPs)
+		m = append(m, func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error {
+				if containsIP(nets, net.ParseIP(c.RealIP())) {
+					return next(c)
+				}
+				return echo.ErrForbidden
+			}
+		})
+	}
+	if len(conf.Users) > 0 {
+		m = append(m, middleware.BasicAuth(func(user, password string, c echo.Context) (bool, error) {
+			expect, ok := conf.Users[user]
+			return ok && subtle.ConstantTimeCompare([]byte(expect), []byte(password)) == 1, nil
+		}))
+	}
+	return m
+}
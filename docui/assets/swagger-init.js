@@ -0,0 +1,6 @@
+// 页面不使用内联脚本,以便在限制script-src的CSP下正常工作
+window.ui = SwaggerUIBundle({
+    url: document.getElementById("swagger-ui").getAttribute("data-spec"),
+    dom_id: "#swagger-ui",
+    deepLinking: true
+});
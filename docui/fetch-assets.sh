@@ -0,0 +1,26 @@
+#!/bin/sh
+# 从npm下载接口文档页面使用的前端资源到docui/assets,更新版本时修改下面的版本号后执行go generate.
+set -e
+
+SWAGGER_UI_VERSION=5.18.2
+REDOC_VERSION=2.1.5
+
+cd "$(dirname "$0")/assets"
+tmp=$(mktemp -d)
+trap 'rm -rf "$tmp"' EXIT
+
+fetch() {
+	curl -fsSL "https://registry.npmjs.org/$1/-/$(basename "$1")-$2.tgz" | tar -xz -C "$tmp"
+	mv "$tmp/package" "$tmp/$1"
+}
+
+fetch swagger-ui-dist "$SWAGGER_UI_VERSION"
+mkdir -p swagger-ui
+cp "$tmp/swagger-ui-dist/swagger-ui-bundle.js" "$tmp/swagger-ui-dist/swagger-ui.css" "$tmp/swagger-ui-dist/LICENSE" swagger-ui/
+
+fetch redoc "$REDOC_VERSION"
+mkdir -p redoc
+cp "$tmp/redoc/bundles/redoc.standalone.js" "$tmp/redoc/LICENSE" redoc/
+
+# 预压缩,由Assets按Accept-Encoding返回
+gzip -9 -k -n -f swagger-ui/swagger-ui-bundle.js swagger-ui/swagger-ui.css redoc/redoc.standalone.js
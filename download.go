@@ -0,0 +1,136 @@
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HeaderDigest 完整内容的摘要(RFC 3230),范围请求时同样为完整内容的摘要,客户端可在续传完成后校验
+const HeaderDigest = "Digest"
+
+// DownloadOptions 下载选项
+type DownloadOptions struct {
+	// Name 下载保存的文件名,支持中文等非ASCII字符,为空时使用文件本身的名称
+	Name string
+
+	// Inline 为true时浏览器直接打开(Content-Disposition: inline),否则作为附件下载
+	Inline bool
+
+	// ContentType 为空时根据文件扩展名推断,无法推断时根据内容检测
+	ContentType string
+
+	// ModTime 最后修改时间,用于Last-Modified及If-Modified-Since,为零值时不发送
+	ModTime time.Time
+
+	// ETag 实体标签(含引号),为空且启用Checksum时使用内容的sha256
+	ETag string
+
+	// Checksum 计算内容的sha256并通过Digest头返回;需要完整读取一次内容,大文件建议由调用方缓存后通过ETag传入
+	Checksum bool
+}
+
+// Download 以附件形式返回content,支持Range(含多段),If-Range,If-Match,If-None-Match及If-Modified-Since等条件请求,
+// 写出的字节数计入c.Response().Size,与日志中的${bytes_out}一致.
+func Download(c echo.Context, content io.ReadSeeker, opt DownloadOptions) error {
+	h := c.Response().Header()
+	if len(opt.ContentType) > 0 {
+		h.Set(echo.HeaderContentType, opt.ContentType)
+	}
+	if opt.Checksum {
+		sum, err := checksum(content)
+		if err != nil {
+			return err
+		}
+		h.Set(HeaderDigest, "sha-256="+base64.StdEncoding.EncodeToString(sum))
+		if len(opt.ETag) == 0 {
+			opt.ETag = `"` + hex.EncodeToString(sum) + `"`
+		}
+	}
+	if len(opt.ETag) > 0 {
+		h.Set("ETag", opt.ETag)
+	}
+	h.Set(echo.HeaderContentDisposition, contentDisposition(opt.Name, opt.Inline))
+	http.ServeContent(c.Response(), c.Request(), opt.Name, opt.ModTime, content)
+	return nil
+}
+
+// DownloadFS 从文件系统(包括embed.FS)下载文件,文件不存在时返回404
+func DownloadFS(c echo.Context, fsys fs.FS, name string, opt DownloadOptions) error {
+	f, err := fsys.Open(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return echo.ErrNotFound
+		}
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return echo.ErrNotFound
+	}
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		return errors.New("download: file does not implement io.ReadSeeker")
+	}
+	if len(opt.Name) == 0 {
+		opt.Name = fi.Name()
+	}
+	if opt.ModTime.IsZero() {
+		opt.ModTime = fi.ModTime()
+	}
+	return Download(c, content, opt)
+}
+
+// DownloadFile 下载本地文件
+func DownloadFile(c echo.Context, file string, opt DownloadOptions) error {
+	return DownloadFS(c, os.DirFS(filepath.Dir(file)), filepath.Base(file), opt)
+}
+
+func checksum(content io.ReadSeeker) ([]byte, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, content); err != nil {
+		return nil, err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// 按RFC 6266生成Content-Disposition,非ASCII文件名同时提供ASCII回退名及filename*
+func contentDisposition(name string, inline bool) string {
+	typ := "attachment"
+	if inline {
+		typ = "inline"
+	}
+	if len(name) == 0 {
+		return typ
+	}
+	fallback := strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, name)
+	v := typ + `; filename="` + fallback + `"`
+	if fallback != name {
+		// filename*只允许attr-char,url.PathEscape未转义的字符中"=",":","@"不属于attr-char
+		v += "; filename*=UTF-8''" + strings.NewReplacer("=", "%3D", ":", "%3A", "@", "%40").Replace(url.PathEscape(name))
+	}
+	return v
+}
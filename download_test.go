@@ -0,0 +1,103 @@
+package web_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/aluka-7/web"
+	"github.com/labstack/echo/v4"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDownload(t *testing.T) {
+	Convey("test Download\n", t, func() {
+		content := []byte("0123456789abcdefghij")
+		modTime := time.Date(2022, 6, 1, 8, 0, 0, 0, time.UTC)
+		dir, err := ioutil.TempDir("", "download")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		So(ioutil.WriteFile(filepath.Join(dir, "report.csv"), content, 0644), ShouldBeNil)
+		fsys := fstest.MapFS{"data/report.txt": {Data: content, ModTime: modTime}}
+
+		var size int64
+		e := echo.New()
+		e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error {
+				err := next(c)
+				size = c.Response().Size
+				return err
+			}
+		})
+		e.GET("/reader", func(c echo.Context) error {
+			return web.Download(c, bytes.NewReader(content), web.DownloadOptions{Name: "月度报表 2022.txt", ModTime: modTime, Checksum: true})
+		})
+		e.GET("/fs/*", func(c echo.Context) error {
+			return web.DownloadFS(c, fsys, c.Param("*"), web.DownloadOptions{Inline: true})
+		})
+		e.GET("/file", func(c echo.Context) error {
+			return web.DownloadFile(c, filepath.Join(dir, "report.csv"), web.DownloadOptions{})
+		})
+		do := func(target string, header ...string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, target, nil)
+			for i := 0; i < len(header); i += 2 {
+				req.Header.Set(header[i], header[i+1])
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			return rec
+		}
+
+		rec := do("/reader")
+		So(rec.Code, ShouldEqual, http.StatusOK)
+		So(rec.Body.Bytes(), ShouldResemble, content)
+		So(size, ShouldEqual, len(content))
+		So(rec.Header().Get(echo.HeaderContentType), ShouldStartWith, "text/plain")
+		So(rec.Header().Get(echo.HeaderContentDisposition), ShouldEqual,
+			`attachment; filename="____ 2022.txt"; filename*=UTF-8''%E6%9C%88%E5%BA%A6%E6%8A%A5%E8%A1%A8%202022.txt`)
+		sum := sha256.Sum256(content)
+		So(rec.Header().Get(web.HeaderDigest), ShouldEqual, "sha-256="+base64.StdEncoding.EncodeToString(sum[:]))
+		etag := rec.Header().Get("ETag")
+		So(etag, ShouldNotBeEmpty)
+		So(rec.Header().Get(echo.HeaderLastModified), ShouldEqual, modTime.Format(http.TimeFormat))
+
+		// 单段与多段范围
+		rec = do("/reader", "Range", "bytes=5-9")
+		So(rec.Code, ShouldEqual, http.StatusPartialContent)
+		So(rec.Body.String(), ShouldEqual, "56789")
+		So(rec.Header().Get("Content-Range"), ShouldEqual, "bytes 5-9/20")
+		So(size, ShouldEqual, 5)
+		rec = do("/reader", "Range", "bytes=0-1,-2")
+		So(rec.Code, ShouldEqual, http.StatusPartialContent)
+		So(rec.Header().Get(echo.HeaderContentType), ShouldStartWith, "multipart/byteranges")
+		So(rec.Body.String(), ShouldContainSubstring, "01")
+		So(rec.Body.String(), ShouldContainSubstring, "ij")
+		So(do("/reader", "Range", "bytes=30-").Code, ShouldEqual, http.StatusRequestedRangeNotSatisfiable)
+
+		// 条件请求
+		So(do("/reader", "Range", "bytes=5-9", "If-Range", etag).Code, ShouldEqual, http.StatusPartialContent)
+		So(do("/reader", "Range", "bytes=5-9", "If-Range", `"changed"`).Code, ShouldEqual, http.StatusOK)
+		So(do("/reader", "If-None-Match", etag).Code, ShouldEqual, http.StatusNotModified)
+		So(do("/reader", "If-Match", `"changed"`).Code, ShouldEqual, http.StatusPreconditionFailed)
+
+		// fs.FS及本地文件
+		rec = do("/fs/data/report.txt", "If-Modified-Since", modTime.Format(http.TimeFormat))
+		So(rec.Code, ShouldEqual, http.StatusNotModified)
+		rec = do("/fs/data/report.txt")
+		So(rec.Header().Get(echo.HeaderContentDisposition), ShouldEqual, `inline; filename="report.txt"`)
+		So(rec.Body.Bytes(), ShouldResemble, content)
+		So(do("/fs/data").Code, ShouldEqual, http.StatusNotFound)
+		So(do("/fs/missing.txt").Code, ShouldEqual, http.StatusNotFound)
+		rec = do("/file", "Range", "bytes=-3")
+		So(rec.Body.String(), ShouldEqual, "hij")
+		So(rec.Header().Get(echo.HeaderContentDisposition), ShouldEqual, `attachment; filename="report.csv"`)
+	})
+}
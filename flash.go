@@ -0,0 +1,121 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// 闪存消息分类
+const (
+	FlashSuccess = "success"
+	FlashInfo    = "info"
+	FlashWarning = "warning"
+	FlashError   = "error"
+)
+
+const (
+	flashKey        = "_flash"
+	flashPendingKey = "web.flash"
+)
+
+// FlashCookieStore 未使用会话中间件时,闪存消息保存在由该存储签名的cookie中,例如NewCookieSessionStore(key, nil).
+var FlashCookieStore SessionStore
+
+var errFlashStore = errors.New("flash: session middleware or FlashCookieStore is required")
+
+// FlashMessage 一条闪存消息
+type FlashMessage struct {
+	Category string `json:"category"`
+	Message  string `json:"message"`
+}
+
+// Flash 待显示的闪存消息,模板中通过.Flash访问,例如:
+//
+//	{{range .Flash.Error}}<div class="alert">{{.}}</div>{{end}}
+type Flash []FlashMessage
+
+// Get 返回指定分类的消息
+func (f Flash) Get(category string) []string {
+	var list []string
+	for _, m := range f {
+		if m.Category == category {
+			list = append(list, m.Message)
+		}
+	}
+	return list
+}
+
+func (f Flash) Success() []string { return f.Get(FlashSuccess) }
+func (f Flash) Info() []string    { return f.Get(FlashInfo) }
+func (f Flash) Warning() []string { return f.Get(FlashWarning) }
+func (f Flash) Error() []string   { return f.Get(FlashError) }
+
+// AddFlash 添加一条在下一次请求中显示的消息,优先保存在会话中,否则保存在签名cookie中.
+func AddFlash(c echo.Context, category, message string) error {
+	m := FlashMessage{Category: category, Message: message}
+	if s := Session(c); s != nil {
+		s.Set(flashKey, append(toFlash(s.Get(flashKey)), m))
+		return nil
+	}
+	if FlashCookieStore == nil {
+		return errFlashStore
+	}
+	pending, ok := c.Get(flashPendingKey).(*Flash)
+	if !ok {
+		pending = new(Flash)
+		c.Set(flashPendingKey, pending)
+		c.Response().Before(func() {
+			value, err := FlashCookieStore.Save(&SessionRecord{Values: map[string]interface{}{flashKey: *pending}})
+			if err != nil {
+				c.Logger().Errorf("保存闪存消息出错:%+v", err)
+				return
+			}
+			c.SetCookie(&http.Cookie{Name: flashKey, Value: value, Path: "/", HttpOnly: true})
+		})
+	}
+	*pending = append(*pending, m)
+	return nil
+}
+
+// Flashes 取出上一次请求添加的消息,取出后消息即被删除.
+func Flashes(c echo.Context) Flash {
+	if s := Session(c); s != nil {
+		v := s.Get(flashKey)
+		if v == nil {
+			return nil
+		}
+		s.Delete(flashKey)
+		return toFlash(v)
+	}
+	if FlashCookieStore == nil {
+		return nil
+	}
+	cookie, err := c.Cookie(flashKey)
+	if err != nil {
+		return nil
+	}
+	c.SetCookie(&http.Cookie{Name: flashKey, Path: "/", MaxAge: -1, HttpOnly: true})
+	r, err := FlashCookieStore.Load(cookie.Value)
+	if err != nil || r == nil {
+		return nil
+	}
+	return toFlash(r.Values[flashKey])
+}
+
+// 会话值经过JSON编码的存储后类型会丢失,需要重新转换
+func toFlash(v interface{}) Flash {
+	switch f := v.(type) {
+	case nil:
+		return nil
+	case Flash:
+		return f
+	}
+	var f Flash
+	if b, err := json.Marshal(v); err == nil {
+		_ = json.Unmarshal(b, &f)
+	}
+	return f
+}
@@ -0,0 +1,43 @@
+package web_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aluka-7/web"
+	"github.com/labstack/echo/v4"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFlash(t *testing.T) {
+	Convey("test Flash\n", t, func() {
+		e := echo.New()
+		e.Use(web.SessionWithConfig(web.SessionConfig{Store: web.NewMemorySessionStore(0, 0)}))
+		e.POST("/save", func(c echo.Context) error {
+			So(web.AddFlash(c, web.FlashSuccess, "saved"), ShouldBeNil)
+			So(web.AddFlash(c, web.FlashWarning, "check input"), ShouldBeNil)
+			return c.Redirect(http.StatusSeeOther, "/")
+		})
+		e.GET("/", func(c echo.Context) error {
+			f := web.Flashes(c)
+			return c.JSON(http.StatusOK, map[string][]string{"success": f.Success(), "warning": f.Warning(), "error": f.Error()})
+		})
+		req := httptest.NewRequest(http.MethodPost, "/save", nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		cookies := rec.Result().Cookies()
+
+		get := func() string {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for _, c := range cookies {
+				req.AddCookie(c)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			return rec.Body.String()
+		}
+		So(get(), ShouldEqual, `{"error":null,"success":["saved"],"warning":["check input"]}`+"\n")
+		So(get(), ShouldEqual, `{"error":null,"success":null,"warning":null}`+"\n")
+	})
+}
@@ -9,10 +9,16 @@ require (
 	github.com/aluka-7/trace v1.0.3
 	github.com/aluka-7/utils v1.0.2
 	github.com/aluka-7/zipkin v1.0.2
+	github.com/getkin/kin-openapi v0.94.0
 	github.com/go-playground/validator/v10 v10.11.0
+	github.com/golang-jwt/jwt/v4 v4.4.2
+	github.com/golang/protobuf v1.5.2
+	github.com/gorilla/websocket v1.5.0
 	github.com/labstack/echo/v4 v4.8.0
 	github.com/labstack/gommon v0.3.1
+	github.com/pires/go-proxyproto v0.6.2
 	github.com/prometheus/client_golang v1.10.0
 	github.com/smartystreets/goconvey v1.6.4
 	github.com/valyala/fasttemplate v1.2.1
+	github.com/vmihailenco/msgpack/v5 v5.3.5
 )
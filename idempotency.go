@@ -0,0 +1,256 @@
+package web
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aluka-7/metacode"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	HeaderIdempotencyKey     = "Idempotency-Key"
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+)
+
+// IdempotencyRecord 幂等键对应的请求及其首次响应
+type IdempotencyRecord struct {
+	Fingerprint string      `json:"fingerprint"` // 请求方法,路径及请求体的摘要
+	Done        bool        `json:"done"`        // 首次请求是否已处理完毕
+	Status      int         `json:"status"`
+	Header      http.Header `json:"header"`
+	Body        []byte      `json:"body"`
+}
+
+// IdempotencyStore 幂等记录存储,多实例部署时应当使用共享存储实现.
+type IdempotencyStore interface {
+	// Lock 原子地创建处理中的记录,key已存在时返回已有记录及false
+	Lock(key string, r *IdempotencyRecord, ttl time.Duration) (*IdempotencyRecord, bool, error)
+	// Get 返回key对应的记录,不存在时返回nil
+	Get(key string) (*IdempotencyRecord, error)
+	// Save 保存处理完毕的记录
+	Save(key string, r *IdempotencyRecord, ttl time.Duration) error
+	// Delete 删除记录,处理失败时调用以允许客户端重试
+	Delete(key string) error
+}
+
+// IdempotencyConfig 幂等中间件配置
+type IdempotencyConfig struct {
+	// Skipper defines a function to skip middleware.
+	Skipper middleware.Skipper
+
+	// Store 幂等记录存储,默认为进程内存储
+	Store IdempotencyStore
+
+	// TTL 记录保留时间,默认24小时
+	TTL time.Duration
+
+	// LockTTL 处理中记录的保留时间,默认1分钟,应大于请求的最长处理时间.
+	// 进程在处理过程中崩溃时,使用共享存储的key最多锁定该时间
+	LockTTL time.Duration
+
+	// LockWait 相同的key正在处理时等待首次请求完成的时间,超时返回metacode.Conflict,默认为0即不等待
+	LockWait time.Duration
+
+	// Required 为true时缺少Idempotency-Key的请求返回错误
+	Required bool
+}
+
+// IdempotencyWithConfig 幂等中间件:对携带Idempotency-Key的非安全方法请求,首次处理成功(处理器未返回错误且状态码小于500)后保存响应,
+// 之后相同key的请求直接回放该响应并带上Idempotent-Replayed头;相同key但请求不同时返回422.
+// 处理器返回错误(包括metacode及echo.HTTPError表示的4xx错误)或panic时不保存,释放key以允许重试.
+// key按认证主体(见SetSubject)隔离.
+func IdempotencyWithConfig(config IdempotencyConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	if config.Store == nil {
+		config.Store = NewMemoryIdempotencyStore()
+	}
+	if config.TTL == 0 {
+		config.TTL = 24 * time.Hour
+	}
+	if config.LockTTL == 0 {
+		config.LockTTL = time.Minute
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			switch req.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+				return next(c)
+			}
+			if config.Skipper(c) {
+				return next(c)
+			}
+			key := req.Header.Get(HeaderIdempotencyKey)
+			if len(key) == 0 {
+				if config.Required {
+					return metacode.Errorf(metacode.RequestErr, "缺少%s", HeaderIdempotencyKey)
+				}
+				return next(c)
+			}
+			body, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				return err
+			}
+			req.Body = ioutil.NopCloser(bytes.NewReader(body))
+			sum := sha256.New()
+			sum.Write([]byte(req.Method + " " + req.URL.RequestURI() + "\n"))
+			sum.Write(body)
+			fingerprint := hex.EncodeToString(sum.Sum(nil))
+			key = Subject(c) + ":" + key
+
+			existing, ok, err := config.Store.Lock(key, &IdempotencyRecord{Fingerprint: fingerprint}, config.LockTTL)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				if existing.Fingerprint != fingerprint {
+					return metacode.Errorf(metacode.IntCode(-http.StatusUnprocessableEntity), "%s已用于不同的请求", HeaderIdempotencyKey)
+				}
+				if !existing.Done {
+					if existing, err = config.wait(key); err != nil {
+						return err
+					}
+				}
+				if existing == nil || !existing.Done {
+					return metacode.Errorf(metacode.Conflict, "相同%s的请求正在处理", HeaderIdempotencyKey)
+				}
+				return replayResponse(c, existing)
+			}
+
+			res := c.Response()
+			dump := &bodyDumpWriter{ResponseWriter: res.Writer}
+			res.Writer = dump
+			saved := false
+			defer func() {
+				res.Writer = dump.ResponseWriter
+				// 处理失败(包括panic)或保存失败时释放key,允许客户端使用相同的key重试
+				if !saved {
+					if derr := config.Store.Delete(key); derr != nil {
+						c.Logger().Errorf("删除幂等记录出错:%+v", derr)
+					}
+				}
+			}()
+			if err = next(c); err != nil || res.Status >= http.StatusInternalServerError {
+				return err
+			}
+			// 请求id,链路id及Set-Cookie等只属于首次请求,不保存
+			header := res.Header().Clone()
+			stripPerRequestHeaders(header)
+			record := &IdempotencyRecord{
+				Fingerprint: fingerprint,
+				Done:        true,
+				Status:      res.Status,
+				Header:      header,
+				Body:        dump.body.Bytes(),
+			}
+			if err = config.Store.Save(key, record, config.TTL); err != nil {
+				c.Logger().Errorf("保存幂等记录出错:%+v", err)
+				return nil
+			}
+			saved = true
+			return nil
+		}
+	}
+}
+
+// 等待首次请求处理完毕
+func (config IdempotencyConfig) wait(key string) (*IdempotencyRecord, error) {
+	deadline := time.Now().Add(config.LockWait)
+	for time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+		r, err := config.Store.Get(key)
+		if err != nil || r == nil || r.Done {
+			return r, err
+		}
+	}
+	return nil, nil
+}
+
+func replayResponse(c echo.Context, r *IdempotencyRecord) error {
+	// 兼容已保存的旧记录,回放时不覆盖本次请求的请求id及链路id
+	header := r.Header.Clone()
+	stripPerRequestHeaders(header)
+	h := c.Response().Header()
+	for k, v := range header {
+		h[k] = v
+	}
+	h.Set(HeaderIdempotentReplayed, "true")
+	c.Response().WriteHeader(r.Status)
+	_, err := c.Response().Write(r.Body)
+	return err
+}
+
+// NewMemoryIdempotencyStore 创建进程内的幂等记录存储
+func NewMemoryIdempotencyStore() IdempotencyStore {
+	return &memoryIdempotencyStore{records: make(map[string]*memoryIdempotencyRecord)}
+}
+
+type memoryIdempotencyStore struct {
+	lock    sync.Mutex
+	records map[string]*memoryIdempotencyRecord
+	lastGC  time.Time
+}
+
+type memoryIdempotencyRecord struct {
+	record  IdempotencyRecord
+	expires time.Time
+}
+
+func (m *memoryIdempotencyStore) Lock(key string, r *IdempotencyRecord, ttl time.Duration) (*IdempotencyRecord, bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	now := time.Now()
+	m.gc(now)
+	if e, ok := m.records[key]; ok && now.Before(e.expires) {
+		cp := e.record
+		return &cp, false, nil
+	}
+	m.records[key] = &memoryIdempotencyRecord{record: *r, expires: now.Add(ttl)}
+	return nil, true, nil
+}
+
+func (m *memoryIdempotencyStore) Get(key string) (*IdempotencyRecord, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if e, ok := m.records[key]; ok && time.Now().Before(e.expires) {
+		cp := e.record
+		return &cp, nil
+	}
+	return nil, nil
+}
+
+func (m *memoryIdempotencyStore) Save(key string, r *IdempotencyRecord, ttl time.Duration) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.records[key] = &memoryIdempotencyRecord{record: *r, expires: time.Now().Add(ttl)}
+	return nil
+}
+
+func (m *memoryIdempotencyStore) Delete(key string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.records, key)
+	return nil
+}
+
+// 每分钟最多清理一次过期记录
+func (m *memoryIdempotencyStore) gc(now time.Time) {
+	if now.Sub(m.lastGC) < time.Minute {
+		return
+	}
+	m.lastGC = now
+	for k, e := range m.records {
+		if now.After(e.expires) {
+			delete(m.records, k)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package web_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aluka-7/web"
+	"github.com/labstack/echo/v4"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestIdempotency(t *testing.T) {
+	Convey("test Idempotency middleware\n", t, func() {
+		var created int32
+		e := echo.New()
+		e.HTTPErrorHandler = web.HTTPErrorHandler
+		e.Use(web.RecoverWithConfig(web.RecoverConfig{}))
+		e.Use(web.IdempotencyWithConfig(web.IdempotencyConfig{LockWait: time.Second}))
+		e.POST("/orders", func(c echo.Context) error {
+			if c.QueryParam("fail") != "" {
+				return echo.ErrServiceUnavailable
+			}
+			time.Sleep(50 * time.Millisecond)
+			id := atomic.AddInt32(&created, 1)
+			c.Response().Header().Set("X-Order", strconv.Itoa(int(id)))
+			c.Response().Header().Set(echo.HeaderXRequestID, "req-"+strconv.Itoa(int(id)))
+			c.SetCookie(&http.Cookie{Name: "order", Value: strconv.Itoa(int(id))})
+			return c.JSON(http.StatusCreated, map[string]int32{"id": id})
+		})
+		var panicked int32
+		e.POST("/pay", func(c echo.Context) error {
+			if atomic.AddInt32(&panicked, 1) == 1 {
+				panic("boom")
+			}
+			return c.String(http.StatusOK, "paid")
+		})
+		do := func(target, key, body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+			if len(key) > 0 {
+				req.Header.Set(web.HeaderIdempotencyKey, key)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			return rec
+		}
+
+		// 并发的重复请求只处理一次
+		var wg sync.WaitGroup
+		recs := make([]*httptest.ResponseRecorder, 3)
+		for i := range recs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				recs[i] = do("/orders", "k1", `{"sku":1}`)
+			}(i)
+		}
+		wg.Wait()
+		So(atomic.LoadInt32(&created), ShouldEqual, 1)
+		replayed := 0
+		for _, rec := range recs {
+			So(rec.Code, ShouldEqual, http.StatusCreated)
+			So(rec.Body.String(), ShouldEqual, `{"id":1}`+"\n")
+			So(rec.Header().Get("X-Order"), ShouldEqual, "1")
+			if rec.Header().Get(web.HeaderIdempotentReplayed) == "true" {
+				replayed++
+			}
+		}
+		So(replayed, ShouldEqual, 2)
+
+		// 回放时不带首次请求的请求id及Cookie
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"sku":1}`))
+		req.Header.Set(web.HeaderIdempotencyKey, "k1")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		So(rec.Header().Get(web.HeaderIdempotentReplayed), ShouldEqual, "true")
+		So(rec.Header().Get(echo.HeaderXRequestID), ShouldBeEmpty)
+		So(rec.Header().Get(echo.HeaderSetCookie), ShouldBeEmpty)
+
+		// 相同key不同请求体
+		So(do("/orders", "k1", `{"sku":2}`).Code, ShouldEqual, http.StatusUnprocessableEntity)
+
+		// 没有key时每次都处理
+		So(do("/orders", "", `{"sku":1}`).Body.String(), ShouldEqual, `{"id":2}`+"\n")
+
+		// 处理失败不保存,可以重试
+		So(do("/orders?fail=1", "k2", `{}`).Code, ShouldEqual, http.StatusServiceUnavailable)
+		So(do("/orders?fail=1", "k2", `{}`).Code, ShouldEqual, http.StatusServiceUnavailable)
+
+		// 处理器panic后释放key,重试不会返回409
+		So(do("/pay", "k3", `{}`).Code, ShouldEqual, http.StatusInternalServerError)
+		So(do("/pay", "k3", `{}`).Body.String(), ShouldEqual, "paid")
+	})
+}
+
+func TestIdempotencyLockTTL(t *testing.T) {
+	Convey("test Idempotency in-flight lock expiry\n", t, func() {
+		var calls int32
+		e := echo.New()
+		e.HTTPErrorHandler = web.HTTPErrorHandler
+		e.Use(web.IdempotencyWithConfig(web.IdempotencyConfig{LockTTL: 50 * time.Millisecond}))
+		e.POST("/jobs", func(c echo.Context) error {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				// 模拟处理过程中卡住的实例
+				time.Sleep(200 * time.Millisecond)
+			}
+			return c.NoContent(http.StatusAccepted)
+		})
+		do := func() int {
+			req := httptest.NewRequest(http.MethodPost, "/jobs", strings.NewReader(`{}`))
+			req.Header.Set(web.HeaderIdempotencyKey, "j1")
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			return rec.Code
+		}
+		go do()
+		time.Sleep(20 * time.Millisecond)
+		So(do(), ShouldEqual, http.StatusConflict)
+		// 处理中记录过期后不再返回409
+		time.Sleep(60 * time.Millisecond)
+		So(do(), ShouldEqual, http.StatusAccepted)
+	})
+}
@@ -0,0 +1,134 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/aluka-7/configuration"
+	"github.com/aluka-7/metacode"
+	"github.com/aluka-7/metric"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+var _metricIPDenied = metric.NewCounterVec(&metric.CounterVecOpts{
+	Namespace: serverNamespace,
+	Subsystem: "ipfilter",
+	Name:      "denied_total",
+	Help:      "http server ip filter denied count.",
+	Labels:    []string{"path", "filter"},
+})
+
+// IPRules IP访问规则,元素为IP或CIDR.命中Deny时拒绝;Allow不为空时只允许命中Allow的地址.
+type IPRules struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+// IPFilter IP访问控制,规则可在运行时更新
+type IPFilter struct {
+	name  string
+	lock  sync.RWMutex
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// NewIPFilter 使用给定规则创建,name用于日志和指标
+func NewIPFilter(name string, rules IPRules) (*IPFilter, error) {
+	f := &IPFilter{name: name}
+	if err := f.Update(rules); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// NewIPFilterFromConfig 从配置中心/system/base/ipfilter/{systemId}/{name}加载规则,配置变化时自动更新.
+// 配置无效时保留原有规则,首次加载失败时拒绝全部访问.
+func NewIPFilterFromConfig(conf configuration.Configuration, systemId, name string) *IPFilter {
+	// 在加载到有效配置前不允许任何地址
+	f := &IPFilter{name: name, deny: parseCIDRs([]string{"0.0.0.0/0", "::/0"})}
+	conf.Get("base", "ipfilter", systemId, []string{name}, f)
+	return f
+}
+
+// Changed 实现configuration.ChangedListener
+func (f *IPFilter) Changed(data map[string]string) {
+	for path, v := range data {
+		var rules IPRules
+		err := json.Unmarshal([]byte(v), &rules)
+		if err == nil {
+			err = f.Update(rules)
+		}
+		if err != nil {
+			fmt.Printf("更新IP访问规则[%s]出错:%+v\n", path, err)
+		}
+	}
+}
+
+// Update 替换访问规则
+func (f *IPFilter) Update(rules IPRules) error {
+	allow, err := parseCIDRList(rules.Allow)
+	if err != nil {
+		return err
+	}
+	deny, err := parseCIDRList(rules.Deny)
+	if err != nil {
+		return err
+	}
+	f.lock.Lock()
+	f.allow, f.deny = allow, deny
+	f.lock.Unlock()
+	return nil
+}
+
+// Allowed 判断IP是否允许访问
+func (f *IPFilter) Allowed(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	if containsIP(f.deny, ip) {
+		return false
+	}
+	return len(f.allow) == 0 || containsIP(f.allow, ip)
+}
+
+// IPFilterConfig IP访问控制中间件配置
+type IPFilterConfig struct {
+	// Skipper defines a function to skip middleware.
+	Skipper middleware.Skipper
+
+	// Filter 访问规则,必填
+	Filter *IPFilter
+}
+
+// IPFilterWithConfig IP访问控制中间件,通常用于路由组,例如:
+//
+//	admin := eng.Group("/admin", web.IPFilterWithConfig(web.IPFilterConfig{Filter: web.NewIPFilterFromConfig(conf, systemId, "admin")}))
+//
+// 客户端IP取自c.RealIP(),经过代理时需要配置Config.TrustedProxies.拒绝时返回metacode.AccessDenied并记录日志和指标.
+func IPFilterWithConfig(config IPFilterConfig) echo.MiddlewareFunc {
+	if config.Filter == nil {
+		panic("ip filter is required")
+	}
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+			ip := c.RealIP()
+			if !config.Filter.Allowed(net.ParseIP(ip)) {
+				_metricIPDenied.Inc(c.Path(), config.Filter.name)
+				c.Logger().Warnf("拒绝IP访问:ip=%s filter=%s route=%s %s", ip, config.Filter.name, c.Request().Method, c.Path())
+				return metacode.Errorf(metacode.AccessDenied, "禁止访问")
+			}
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package web_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aluka-7/web"
+	"github.com/labstack/echo/v4"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestIPFilter(t *testing.T) {
+	Convey("test IPFilter middleware\n", t, func() {
+		filter, err := web.NewIPFilter("admin", web.IPRules{Allow: []string{"10.0.0.0/8", "192.168.1.10"}, Deny: []string{"10.0.9.0/24"}})
+		So(err, ShouldBeNil)
+		_, err = web.NewIPFilter("bad", web.IPRules{Allow: []string{"10.0.0.0/33"}})
+		So(err, ShouldNotBeNil)
+
+		e := echo.New()
+		e.HTTPErrorHandler = web.HTTPErrorHandler
+		ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+		e.GET("/public", ok)
+		admin := e.Group("/admin", web.IPFilterWithConfig(web.IPFilterConfig{Filter: filter}))
+		admin.GET("/users", ok)
+		do := func(path, ip string) int {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			req.RemoteAddr = ip + ":1234"
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			return rec.Code
+		}
+
+		So(do("/public", "8.8.8.8"), ShouldEqual, http.StatusOK)
+		So(do("/admin/users", "8.8.8.8"), ShouldEqual, http.StatusForbidden)
+		So(do("/admin/users", "10.1.2.3"), ShouldEqual, http.StatusOK)
+		So(do("/admin/users", "10.0.9.1"), ShouldEqual, http.StatusForbidden)
+		So(do("/admin/users", "192.168.1.10"), ShouldEqual, http.StatusOK)
+
+		// 配置更新后立即生效,无效配置保留原规则
+		filter.Changed(map[string]string{"/system/base/ipfilter/test/admin": `{"allow":["8.8.8.0/24"]}`})
+		So(do("/admin/users", "8.8.8.8"), ShouldEqual, http.StatusOK)
+		So(do("/admin/users", "10.1.2.3"), ShouldEqual, http.StatusForbidden)
+		filter.Changed(map[string]string{"/system/base/ipfilter/test/admin": `{"allow":["bad"]}`})
+		So(do("/admin/users", "8.8.8.8"), ShouldEqual, http.StatusOK)
+	})
+}
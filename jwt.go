@@ -0,0 +1,306 @@
+package web
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aluka-7/configuration"
+	"github.com/aluka-7/metacode"
+	"github.com/aluka-7/trace"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	jwtClaimsKey  = "web.jwt.claims"
+	subjectKey    = "web.subject"
+	tagUserID     = "user.id"
+	jwtAuthScheme = "Bearer"
+)
+
+// JWTConfig JWT认证中间件配置
+type JWTConfig struct {
+	// Skipper defines a function to skip middleware.
+	Skipper middleware.Skipper
+
+	// Keys 验证签名的密钥集合,必填
+	Keys *JWTKeySet
+
+	// Algorithms 允许的签名算法,默认为HS,RS,ES,PS系列全部算法
+	Algorithms []string
+
+	// Issuer 不为空时校验iss
+	Issuer string
+
+	// Audience 不为空时要求aud至少包含其中之一
+	Audience []string
+
+	// ClockSkew 校验exp,nbf,iat时允许的时钟偏差
+	ClockSkew time.Duration
+
+	// Cookie 请求头中没有令牌时从该cookie读取,为空时不读取
+	Cookie string
+
+	// NewClaims 创建自定义声明类型,默认为*jwt.RegisteredClaims,通过JWTClaims取出后断言为该类型
+	NewClaims func() jwt.Claims
+}
+
+var defaultJWTAlgorithms = []string{
+	"HS256", "HS384", "HS512", "RS256", "RS384", "RS512",
+	"ES256", "ES384", "ES512", "PS256", "PS384", "PS512",
+}
+
+// JWTWithConfig 校验请求中的JWT令牌,通过后声明放入上下文,主题(sub)写入访问日志和跟踪标签,
+// 失败时返回metacode.Unauthorized错误.
+func JWTWithConfig(config JWTConfig) echo.MiddlewareFunc {
+	if config.Keys == nil {
+		panic("jwt keys is required")
+	}
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	if len(config.Algorithms) == 0 {
+		config.Algorithms = defaultJWTAlgorithms
+	}
+	if config.NewClaims == nil {
+		config.NewClaims = func() jwt.Claims { return new(jwt.RegisteredClaims) }
+	}
+	parser := jwt.NewParser(jwt.WithValidMethods(config.Algorithms), jwt.WithoutClaimsValidation())
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+			raw := bearerToken(c, config.Cookie)
+			if len(raw) == 0 {
+				return metacode.Errorf(metacode.Unauthorized, "缺少认证令牌")
+			}
+			claims := config.NewClaims()
+			if _, err := parser.ParseWithClaims(raw, claims, config.Keys.keyFunc); err != nil {
+				return metacode.Errorf(metacode.Unauthorized, "认证令牌无效[%s]", err)
+			}
+			var registered jwt.RegisteredClaims
+			if _, _, err := parser.ParseUnverified(raw, &registered); err != nil {
+				return metacode.Errorf(metacode.Unauthorized, "认证令牌无效[%s]", err)
+			}
+			if err := config.verify(&registered, time.Now()); err != nil {
+				return metacode.Errorf(metacode.Unauthorized, "认证令牌无效[%s]", err)
+			}
+			c.Set(jwtClaimsKey, claims)
+			SetSubject(c, registered.Subject)
+			return next(c)
+		}
+	}
+}
+
+func (config JWTConfig) verify(r *jwt.RegisteredClaims, now time.Time) error {
+	if r.ExpiresAt != nil && now.After(r.ExpiresAt.Add(config.ClockSkew)) {
+		return fmt.Errorf("token is expired")
+	}
+	if r.NotBefore != nil && now.Add(config.ClockSkew).Before(r.NotBefore.Time) {
+		return fmt.Errorf("token is not valid yet")
+	}
+	if r.IssuedAt != nil && now.Add(config.ClockSkew).Before(r.IssuedAt.Time) {
+		return fmt.Errorf("token used before issued")
+	}
+	if len(config.Issuer) > 0 && r.Issuer != config.Issuer {
+		return fmt.Errorf("invalid issuer %q", r.Issuer)
+	}
+	if len(config.Audience) > 0 {
+		for _, want := range config.Audience {
+			for _, aud := range r.Audience {
+				if aud == want {
+					return nil
+				}
+			}
+		}
+		return fmt.Errorf("invalid audience %v", r.Audience)
+	}
+	return nil
+}
+
+func bearerToken(c echo.Context, cookie string) string {
+	auth := c.Request().Header.Get(echo.HeaderAuthorization)
+	if len(auth) > len(jwtAuthScheme)+1 && strings.EqualFold(auth[:len(jwtAuthScheme)], jwtAuthScheme) {
+		return strings.TrimSpace(auth[len(jwtAuthScheme)+1:])
+	}
+	if len(cookie) > 0 {
+		if ck, err := c.Cookie(cookie); err == nil {
+			return ck.Value
+		}
+	}
+	return ""
+}
+
+// JWTClaims 返回JWT中间件解析出的声明,类型由JWTConfig.NewClaims决定.
+func JWTClaims(c echo.Context) jwt.Claims {
+	claims, _ := c.Get(jwtClaimsKey).(jwt.Claims)
+	return claims
+}
+
+// SetSubject 设置当前请求的认证主体,会写入访问日志的subject字段以及跟踪的user.id标签.
+func SetSubject(c echo.Context, subject string) {
+	c.Set(subjectKey, subject)
+	if t, ok := trace.FromContext(c.Request().Context()); ok {
+		t.SetTag(trace.String(tagUserID, subject))
+	}
+}
+
+// Subject 返回当前请求的认证主体
+func Subject(c echo.Context) string {
+	s, _ := c.Get(subjectKey).(string)
+	return s
+}
+
+// JWTKeySet 按kid索引的验证密钥集合,支持在运行时整体替换以实现密钥轮换.
+type JWTKeySet struct {
+	lock sync.RWMutex
+	keys map[string]interface{}
+}
+
+// NewJWTKeySet 根据JWKS(JSON Web Key Set)创建密钥集合
+func NewJWTKeySet(jwks []byte) (*JWTKeySet, error) {
+	ks := new(JWTKeySet)
+	if err := ks.Update(jwks); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// NewJWTKeySetFromFile 从JWKS文件加载密钥,refresh大于0时定期重新加载以支持密钥轮换.
+func NewJWTKeySetFromFile(file string, refresh time.Duration) (*JWTKeySet, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	ks, err := NewJWTKeySet(data)
+	if err != nil {
+		return nil, err
+	}
+	if refresh > 0 {
+		go func() {
+			for range time.Tick(refresh) {
+				if data, err := ioutil.ReadFile(file); err == nil {
+					if err = ks.Update(data); err != nil {
+						fmt.Printf("重新加载JWKS文件[%s]出错:%+v\n", file, err)
+					}
+				}
+			}
+		}()
+	}
+	return ks, nil
+}
+
+// NewJWTKeySetFromConfig 从配置中心/system/base/jwt/{systemId}加载JWKS,配置变化时自动更新.
+func NewJWTKeySetFromConfig(conf configuration.Configuration, systemId string) *JWTKeySet {
+	ks := new(JWTKeySet)
+	conf.Get("base", "jwt", "", []string{systemId}, ks)
+	return ks
+}
+
+// Changed 实现configuration.ChangedListener
+func (ks *JWTKeySet) Changed(data map[string]string) {
+	for path, v := range data {
+		if err := ks.Update([]byte(v)); err != nil {
+			fmt.Printf("更新JWKS配置[%s]出错:%+v\n", path, err)
+		}
+	}
+}
+
+// Update 使用新的JWKS替换全部密钥
+func (ks *JWTKeySet) Update(jwks []byte) error {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(jwks, &set); err != nil {
+		return err
+	}
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, k := range set.Keys {
+		key, err := k.key()
+		if err != nil {
+			return fmt.Errorf("jwk[%s]: %v", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+	ks.lock.Lock()
+	ks.keys = keys
+	ks.lock.Unlock()
+	return nil
+}
+
+// 根据kid查找密钥,令牌未指定kid时使用唯一的一个密钥
+func (ks *JWTKeySet) keyFunc(t *jwt.Token) (interface{}, error) {
+	ks.lock.RLock()
+	defer ks.lock.RUnlock()
+	kid, _ := t.Header["kid"].(string)
+	if key, ok := ks.keys[kid]; ok {
+		return key, nil
+	}
+	if len(kid) == 0 && len(ks.keys) == 1 {
+		for _, key := range ks.keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	K   string `json:"k"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) key() (interface{}, error) {
+	switch k.Kty {
+	case "oct":
+		return base64.RawURLEncoding.DecodeString(k.K)
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
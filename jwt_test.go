@@ -0,0 +1,92 @@
+package web_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aluka-7/web"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/labstack/echo/v4"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestJWT(t *testing.T) {
+	Convey("test JWT middleware\n", t, func() {
+		rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		So(err, ShouldBeNil)
+		b64 := base64.RawURLEncoding.EncodeToString
+		secret := []byte("hs-secret")
+		jwks := fmt.Sprintf(`{"keys":[{"kty":"oct","kid":"hs","k":"%s"},{"kty":"RSA","kid":"rs","n":"%s","e":"%s"}]}`,
+			b64(secret), b64(rsaKey.N.Bytes()), b64(big.NewInt(int64(rsaKey.E)).Bytes()))
+		keys, err := web.NewJWTKeySet([]byte(jwks))
+		So(err, ShouldBeNil)
+
+		e := echo.New()
+		e.HTTPErrorHandler = web.HTTPErrorHandler
+		e.Use(web.JWTWithConfig(web.JWTConfig{
+			Keys:      keys,
+			Issuer:    "https://idp.example.com",
+			Audience:  []string{"api"},
+			ClockSkew: 30 * time.Second,
+		}))
+		e.GET("/me", func(c echo.Context) error {
+			claims := web.JWTClaims(c).(*jwt.RegisteredClaims)
+			return c.String(http.StatusOK, web.Subject(c)+","+claims.ID)
+		})
+		sign := func(method jwt.SigningMethod, kid string, key interface{}, claims jwt.RegisteredClaims) string {
+			token := jwt.NewWithClaims(method, claims)
+			token.Header["kid"] = kid
+			s, err := token.SignedString(key)
+			So(err, ShouldBeNil)
+			return s
+		}
+		do := func(token string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, "/me", nil)
+			if len(token) > 0 {
+				req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			return rec
+		}
+		claims := func(exp time.Duration) jwt.RegisteredClaims {
+			return jwt.RegisteredClaims{
+				Subject:   "tom",
+				ID:        "1",
+				Issuer:    "https://idp.example.com",
+				Audience:  jwt.ClaimStrings{"web", "api"},
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(exp)),
+			}
+		}
+
+		rec := do(sign(jwt.SigningMethodHS256, "hs", secret, claims(time.Minute)))
+		So(rec.Code, ShouldEqual, http.StatusOK)
+		So(rec.Body.String(), ShouldEqual, "tom,1")
+		So(do(sign(jwt.SigningMethodRS256, "rs", rsaKey, claims(time.Minute))).Code, ShouldEqual, http.StatusOK)
+
+		// 时钟偏差范围内过期的令牌仍然有效
+		So(do(sign(jwt.SigningMethodRS256, "rs", rsaKey, claims(-10*time.Second))).Code, ShouldEqual, http.StatusOK)
+		So(do(sign(jwt.SigningMethodRS256, "rs", rsaKey, claims(-time.Minute))).Code, ShouldEqual, http.StatusUnauthorized)
+
+		wrong := claims(time.Minute)
+		wrong.Audience = jwt.ClaimStrings{"other"}
+		So(do(sign(jwt.SigningMethodHS256, "hs", secret, wrong)).Code, ShouldEqual, http.StatusUnauthorized)
+		wrong = claims(time.Minute)
+		wrong.Issuer = "evil"
+		So(do(sign(jwt.SigningMethodHS256, "hs", secret, wrong)).Code, ShouldEqual, http.StatusUnauthorized)
+		So(do(sign(jwt.SigningMethodHS256, "hs", []byte("other"), claims(time.Minute))).Code, ShouldEqual, http.StatusUnauthorized)
+		So(do("").Code, ShouldEqual, http.StatusUnauthorized)
+
+		// 密钥轮换后旧密钥签名的令牌失效
+		So(keys.Update([]byte(fmt.Sprintf(`{"keys":[{"kty":"oct","kid":"hs2","k":"%s"}]}`, b64([]byte("new"))))), ShouldBeNil)
+		So(do(sign(jwt.SigningMethodHS256, "hs", secret, claims(time.Minute))).Code, ShouldEqual, http.StatusUnauthorized)
+		So(do(sign(jwt.SigningMethodHS256, "hs2", []byte("new"), claims(time.Minute))).Code, ShouldEqual, http.StatusOK)
+	})
+}
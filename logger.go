@@ -3,6 +3,7 @@ package web
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
 	"strconv"
 	"strings"
@@ -10,6 +11,7 @@ import (
 	"time"
 
 	"github.com/aluka-7/metacode"
+	"github.com/aluka-7/trace"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/labstack/gommon/color"
@@ -44,6 +46,14 @@ type (
 		// - latency_human (Human readable)
 		// - bytes_in (Bytes received)
 		// - bytes_out (Bytes sent)
+		// - subject (Authenticated subject, see SetSubject)
+		// - level (info, warn for 4xx, error for 5xx)
+		// - trace_id (Trace ID, see Trace)
+		// - span_id (Span ID)
+		// - route (Route path pattern, e.g. /users/:id)
+		// - code (metacode of the returned error, 0 on success)
+		// - caller (Calling application from X-App-Key header)
+		// - system_id
 		// - header:<NAME>
 		// - query:<NAME>
 		// - form:<NAME>
@@ -53,6 +63,17 @@ type (
 		// Optional. Default value DefaultLoggerConfig.Format.
 		Format string `yaml:"format"`
 
+		// Encoder 结构化输出格式,"json"或"logfmt",按Fields的顺序输出标签值并正确编码;为空时使用Format模板.
+		// 结构化输出的第一个字段总是level.
+		Encoder string `yaml:"encoder"`
+
+		// Fields 结构化输出的标签,取值同Format中的标签.
+		// Optional. Default value DefaultLoggerConfig.Fields.
+		Fields []string `yaml:"fields"`
+
+		// MinLevel 最低输出级别,"info","warn"或"error",默认输出全部
+		MinLevel string `yaml:"min_level"`
+
 		// Optional. Default value DefaultLoggerConfig.CustomTimeFormat.
 		CustomTimeFormat string `yaml:"custom_time_format"`
 
@@ -60,6 +81,7 @@ type (
 		// Optional. Default value os.Stdout.
 		Output io.Writer
 
+		systemId string
 		template *fasttemplate.Template
 		colorist *color.Color
 		pool     *sync.Pool
@@ -70,10 +92,13 @@ var (
 	// DefaultLoggerConfig is the default Logger middleware config.
 	DefaultLoggerConfig = LoggerConfig{
 		Skipper: middleware.DefaultSkipper,
-		Format: `{"time":"${time_rfc3339_nano}","id":"${id}","remote_ip":"${remote_ip}",` +
-			`"host":"${host}","method":"${method}","uri":"${uri}","user_agent":"${user_agent}",` +
-			`"status":${status},"error":"${error}","latency":${latency},"latency_human":"${latency_human}"` +
+		Format: `{"time":"${time_rfc3339_nano}","id":"${id}","trace_id":"${trace_id}","span_id":"${span_id}",` +
+			`"system_id":"${system_id}","caller":"${caller}","remote_ip":"${remote_ip}",` +
+			`"host":"${host}","method":"${method}","uri":"${uri}","route":"${route}","user_agent":"${user_agent}",` +
+			`"status":${status},"code":${code},"error":"${error}","subject":"${subject}","latency":${latency},"latency_human":"${latency_human}"` +
 			`,"bytes_in":${bytes_in},"bytes_out":${bytes_out}}` + "\n",
+		Fields: []string{"time_rfc3339_nano", "id", "trace_id", "span_id", "system_id", "caller", "remote_ip", "host", "method", "uri", "route",
+			"user_agent", "status", "code", "error", "subject", "latency", "latency_human", "bytes_in", "bytes_out"},
 		CustomTimeFormat: "2006-01-02 15:04:05.00000",
 		colorist:         color.New(),
 	}
@@ -92,7 +117,19 @@ func LoggerWithConfig(systemId string, enableLog bool, config LoggerConfig) echo
 	if config.Output == nil {
 		config.Output = DefaultLoggerConfig.Output
 	}
+	if len(config.Fields) == 0 {
+		config.Fields = DefaultLoggerConfig.Fields
+	}
 
+	switch config.Encoder {
+	case "", "json", "logfmt":
+	default:
+		panic(fmt.Sprintf("unknown logger encoder %q", config.Encoder))
+	}
+	if _, ok := logLevels[config.MinLevel]; !ok {
+		panic(fmt.Sprintf("unknown logger level %q", config.MinLevel))
+	}
+	config.systemId = systemId
 	config.template = fasttemplate.New(config.Format, "${", "}")
 	config.colorist = color.New()
 	config.colorist.SetOutput(config.Output)
@@ -124,97 +161,59 @@ func LoggerWithConfig(systemId string, enableLog bool, config LoggerConfig) echo
 			if !enableLog {
 				return
 			}
+			level := statusLevel(res.Status)
+			if logLevels[level] < logLevels[config.MinLevel] {
+				return
+			}
 			buf := config.pool.Get().(*bytes.Buffer)
 			buf.Reset()
 			defer config.pool.Put(buf)
-			if _, err = config.template.ExecuteFunc(buf, func(w io.Writer, tag string) (int, error) {
-				switch tag {
-				case "time_unix":
-					return buf.WriteString(strconv.FormatInt(time.Now().Unix(), 10))
-				case "time_unix_nano":
-					return buf.WriteString(strconv.FormatInt(time.Now().UnixNano(), 10))
-				case "time_rfc3339":
-					return buf.WriteString(time.Now().Format(time.RFC3339))
-				case "time_rfc3339_nano":
-					return buf.WriteString(time.Now().Format(time.RFC3339Nano))
-				case "time_custom":
-					return buf.WriteString(time.Now().Format(config.CustomTimeFormat))
-				case "id":
-					id := req.Header.Get(echo.HeaderXRequestID)
-					if id == "" {
-						id = res.Header().Get(echo.HeaderXRequestID)
-					}
-					return buf.WriteString(id)
-				case "remote_ip":
-					return buf.WriteString(c.RealIP())
-				case "host":
-					return buf.WriteString(req.Host)
-				case "uri":
-					return buf.WriteString(req.RequestURI)
-				case "method":
-					return buf.WriteString(req.Method)
-				case "path":
-					p := req.URL.Path
-					if p == "" {
-						p = "/"
-					}
-					return buf.WriteString(p)
-				case "protocol":
-					return buf.WriteString(req.Proto)
-				case "referer":
-					return buf.WriteString(req.Referer())
-				case "user_agent":
-					return buf.WriteString(req.UserAgent())
-				case "status":
-					n := res.Status
-					s := config.colorist.Green(n)
-					switch {
-					case n >= 500:
-						s = config.colorist.Red(n)
-					case n >= 400:
-						s = config.colorist.Yellow(n)
-					case n >= 300:
-						s = config.colorist.Cyan(n)
-					}
-					return buf.WriteString(s)
-				case "error":
-					if err != nil {
-						// Error may contain invalid JSON e.g. `"`
-						b, _ := json.Marshal(err.Error())
-						b = b[1 : len(b)-1]
-						return buf.Write(b)
-					}
-				case "latency":
-					l := stop.Sub(start)
-					return buf.WriteString(strconv.FormatInt(int64(l), 10))
-				case "latency_human":
-					return buf.WriteString(stop.Sub(start).String())
-				case "bytes_in":
-					cl := req.Header.Get(echo.HeaderContentLength)
-					if cl == "" {
-						cl = "0"
-					}
-					return buf.WriteString(cl)
-				case "bytes_out":
-					return buf.WriteString(strconv.FormatInt(res.Size, 10))
-				default:
-					switch {
-					case strings.HasPrefix(tag, "header:"):
-						return buf.Write([]byte(c.Request().Header.Get(tag[7:])))
-					case strings.HasPrefix(tag, "query:"):
-						return buf.Write([]byte(c.QueryParam(tag[6:])))
-					case strings.HasPrefix(tag, "form:"):
-						return buf.Write([]byte(c.FormValue(tag[5:])))
-					case strings.HasPrefix(tag, "cookie:"):
-						cookie, err := c.Cookie(tag[7:])
-						if err == nil {
-							return buf.Write([]byte(cookie.Value))
+			value := func(tag string) interface{} {
+				if tag == "level" {
+					return level
+				}
+				return config.tagValue(c, tag, err, start, stop)
+			}
+			switch config.Encoder {
+			case "json":
+				encodeJSON(buf, config.Fields, value)
+			case "logfmt":
+				encodeLogfmt(buf, config.Fields, value)
+			default:
+				if _, err = config.template.ExecuteFunc(buf, func(w io.Writer, tag string) (int, error) {
+					switch tag {
+					case "status":
+						n := res.Status
+						s := config.colorist.Green(n)
+						switch {
+						case n >= 500:
+							s = config.colorist.Red(n)
+						case n >= 400:
+							s = config.colorist.Yellow(n)
+						case n >= 300:
+							s = config.colorist.Cyan(n)
 						}
+						return buf.WriteString(s)
+					case "error", "subject", "caller":
+						// 可能包含破坏JSON格式的字符,例如`"`
+						if s := value(tag).(string); s != "" {
+							b, _ := json.Marshal(s)
+							return buf.Write(b[1 : len(b)-1])
+						}
+						return 0, nil
+					}
+					switch v := value(tag).(type) {
+					case string:
+						return buf.WriteString(v)
+					case int:
+						return buf.WriteString(strconv.Itoa(v))
+					case int64:
+						return buf.WriteString(strconv.FormatInt(v, 10))
 					}
+					return 0, nil
+				}); err != nil {
+					return
 				}
-				return 0, nil
-			}); err != nil {
-				return
 			}
 
 			if config.Output == nil {
@@ -226,3 +225,168 @@ func LoggerWithConfig(systemId string, enableLog bool, config LoggerConfig) echo
 		}
 	}
 }
+
+// 标签对应的值,结构化模式下按类型编码,模板模式下转换为字符串;未知标签返回nil
+func (config *LoggerConfig) tagValue(c echo.Context, tag string, err error, start, stop time.Time) interface{} {
+	req := c.Request()
+	res := c.Response()
+	switch tag {
+	case "time_unix":
+		return time.Now().Unix()
+	case "time_unix_nano":
+		return time.Now().UnixNano()
+	case "time_rfc3339":
+		return time.Now().Format(time.RFC3339)
+	case "time_rfc3339_nano":
+		return time.Now().Format(time.RFC3339Nano)
+	case "time_custom":
+		return time.Now().Format(config.CustomTimeFormat)
+	case "id":
+		return requestID(c)
+	case "trace_id", "span_id":
+		traceID, spanID := traceIDs(c)
+		if tag == "trace_id" {
+			return traceID
+		}
+		return spanID
+	case "route":
+		return c.Path()
+	case "code":
+		return metacode.Cause(err).Code()
+	case "caller":
+		return req.Header.Get(HeaderAppKey)
+	case "system_id":
+		return config.systemId
+	case "remote_ip":
+		return c.RealIP()
+	case "host":
+		return req.Host
+	case "uri":
+		return req.RequestURI
+	case "method":
+		return req.Method
+	case "path":
+		p := req.URL.Path
+		if p == "" {
+			p = "/"
+		}
+		return p
+	case "protocol":
+		return req.Proto
+	case "referer":
+		return req.Referer()
+	case "user_agent":
+		return req.UserAgent()
+	case "status":
+		return res.Status
+	case "error":
+		if err != nil {
+			return err.Error()
+		}
+		return ""
+	case "subject":
+		return Subject(c)
+	case "latency":
+		return int64(stop.Sub(start))
+	case "latency_human":
+		return stop.Sub(start).String()
+	case "bytes_in":
+		n, _ := strconv.ParseInt(req.Header.Get(echo.HeaderContentLength), 10, 64)
+		return n
+	case "bytes_out":
+		return res.Size
+	}
+	switch {
+	case strings.HasPrefix(tag, "header:"):
+		return req.Header.Get(tag[7:])
+	case strings.HasPrefix(tag, "query:"):
+		return c.QueryParam(tag[6:])
+	case strings.HasPrefix(tag, "form:"):
+		return c.FormValue(tag[5:])
+	case strings.HasPrefix(tag, "cookie:"):
+		if cookie, err := c.Cookie(tag[7:]); err == nil {
+			return cookie.Value
+		}
+		return ""
+	}
+	return nil
+}
+
+var logLevels = map[string]int{"": 0, "info": 0, "warn": 1, "error": 2}
+
+// 按状态码分类的日志级别:5xx为error,4xx为warn,其余为info
+func statusLevel(status int) string {
+	switch {
+	case status >= 500:
+		return "error"
+	case status >= 400:
+		return "warn"
+	}
+	return "info"
+}
+
+// 按fields顺序输出JSON对象,第一个字段为level
+func encodeJSON(buf *bytes.Buffer, fields []string, value func(string) interface{}) {
+	buf.WriteString(`{"level":`)
+	encodeJSONValue(buf, value("level"))
+	for _, f := range fields {
+		// level总是第一个字段,避免重复的key
+		if f == "level" {
+			continue
+		}
+		buf.WriteByte(',')
+		encodeJSONValue(buf, f)
+		buf.WriteByte(':')
+		encodeJSONValue(buf, value(f))
+	}
+	buf.WriteString("}\n")
+}
+
+func encodeJSONValue(buf *bytes.Buffer, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		b, _ = json.Marshal(fmt.Sprint(v))
+	}
+	buf.Write(b)
+}
+
+// 按fields顺序输出logfmt格式,包含空白,引号,等号或控制字符的值加引号
+func encodeLogfmt(buf *bytes.Buffer, fields []string, value func(string) interface{}) {
+	buf.WriteString("level=")
+	buf.WriteString(value("level").(string))
+	for _, f := range fields {
+		if f == "level" {
+			continue
+		}
+		buf.WriteByte(' ')
+		buf.WriteString(f)
+		buf.WriteByte('=')
+		switch v := value(f).(type) {
+		case nil:
+		case string:
+			if v == "" || strings.IndexFunc(v, func(r rune) bool {
+				return r <= ' ' || r == '=' || r == '"' || r == 0x7f
+			}) >= 0 {
+				v = strconv.Quote(v)
+			}
+			buf.WriteString(v)
+		default:
+			fmt.Fprint(buf, v)
+		}
+	}
+	buf.WriteByte('\n')
+}
+
+// 当前请求的跟踪id及span id,TraceId()返回的格式为{TraceId}:{SpanId}:{ParentId}:{flags}
+func traceIDs(c echo.Context) (traceID, spanID string) {
+	t, ok := trace.FromContext(c.Request().Context())
+	if !ok {
+		return
+	}
+	ids := strings.SplitN(t.TraceId(), ":", 3)
+	traceID = ids[0]
+	if len(ids) > 1 {
+		spanID = ids[1]
+	}
+	return
+}
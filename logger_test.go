@@ -0,0 +1,106 @@
+package web_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aluka-7/metacode"
+	"github.com/aluka-7/trace"
+	"github.com/aluka-7/web"
+	"github.com/labstack/echo/v4"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLogger(t *testing.T) {
+	Convey("test Logger encoders\n", t, func() {
+		serve := func(config web.LoggerConfig, target string) string {
+			var out bytes.Buffer
+			config.Output = &out
+			e := echo.New()
+			e.HTTPErrorHandler = web.HTTPErrorHandler
+			e.Use(web.LoggerWithConfig("1000", true, config))
+			e.GET("/ok", func(c echo.Context) error {
+				return c.String(http.StatusOK, "ok")
+			})
+			e.GET("/fail", func(c echo.Context) error {
+				return errors.New(`bad "input"`)
+			})
+			req := httptest.NewRequest(http.MethodGet, target, nil)
+			req.Header.Set("User-Agent", `agent "quoted" \ x`)
+			e.ServeHTTP(httptest.NewRecorder(), req)
+			return out.String()
+		}
+
+		// 结构化JSON输出对所有值正确编码
+		line := serve(web.LoggerConfig{Encoder: "json"}, `/ok?q="x"`)
+		var entry map[string]interface{}
+		So(json.Unmarshal([]byte(line), &entry), ShouldBeNil)
+		So(entry["level"], ShouldEqual, "info")
+		So(entry["status"], ShouldEqual, 200)
+		So(entry["uri"], ShouldEqual, `/ok?q="x"`)
+		So(entry["user_agent"], ShouldEqual, `agent "quoted" \ x`)
+		So(entry["bytes_out"], ShouldEqual, 2)
+		So(strings.Index(line, `"level"`), ShouldBeLessThan, strings.Index(line, `"time_rfc3339_nano"`))
+
+		line = serve(web.LoggerConfig{Encoder: "json", Fields: []string{"status", "error", "query:q"}}, "/fail?q=1")
+		So(line, ShouldEqual, `{"level":"error","status":500,"error":"bad \"input\"","query:q":"1"}`+"\n")
+		line = serve(web.LoggerConfig{Encoder: "json", Fields: []string{"level", "status"}}, "/ok")
+		So(line, ShouldEqual, `{"level":"info","status":200}`+"\n")
+
+		// logfmt
+		line = serve(web.LoggerConfig{Encoder: "logfmt", Fields: []string{"method", "status", "user_agent", "error"}}, "/ok")
+		So(line, ShouldEqual, `level=info method=GET status=200 user_agent="agent \"quoted\" \\ x" error=""`+"\n")
+		So(serve(web.LoggerConfig{Encoder: "logfmt", Fields: []string{"level", "status"}}, "/ok"), ShouldEqual, "level=info status=200\n")
+
+		// 按级别过滤
+		So(serve(web.LoggerConfig{Encoder: "json", MinLevel: "warn"}, "/ok"), ShouldBeEmpty)
+		So(serve(web.LoggerConfig{Encoder: "json", MinLevel: "warn"}, "/fail"), ShouldNotBeEmpty)
+
+		// 模板模式保持不变
+		line = serve(web.LoggerConfig{Format: "${level} ${method} ${status} ${error}\n"}, "/fail")
+		So(line, ShouldEqual, `error GET 500 bad \"input\"`+"\n")
+		So(serve(web.LoggerConfig{}, "/ok"), ShouldContainSubstring, `"method":"GET"`)
+
+		// 未知的输出格式及级别
+		So(func() { web.LoggerWithConfig("1000", true, web.LoggerConfig{Encoder: "text"}) }, ShouldPanic)
+		So(func() { web.LoggerWithConfig("1000", true, web.LoggerConfig{Encoder: "json", MinLevel: "warning"}) }, ShouldPanic)
+	})
+}
+
+func TestLoggerTraceTags(t *testing.T) {
+	Convey("test Logger trace and route tags\n", t, func() {
+		trace.SetGlobalTracer(trace.NewTracer("web", nil, discardReporter{}, true))
+		var out bytes.Buffer
+		e := echo.New()
+		e.HTTPErrorHandler = web.HTTPErrorHandler
+		e.Use(web.Trace(), web.LoggerWithConfig("1000", true, web.LoggerConfig{Output: &out}))
+		e.GET("/users/:id", func(c echo.Context) error {
+			return metacode.Errorf(metacode.AccessDenied, "denied")
+		})
+		req := httptest.NewRequest(http.MethodGet, "/users/42", nil)
+		req.Header.Set(web.HeaderAppKey, "billing")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		// 默认格式为合法的JSON,包含跟踪id
+		var entry map[string]interface{}
+		So(json.Unmarshal(out.Bytes(), &entry), ShouldBeNil)
+		So(entry["trace_id"], ShouldNotBeEmpty)
+		So(entry["trace_id"], ShouldEqual, strings.Split(rec.Header().Get(trace.SystemTraceID), ":")[0])
+		So(entry["span_id"], ShouldNotBeEmpty)
+		So(entry["route"], ShouldEqual, "/users/:id")
+		So(entry["code"], ShouldEqual, metacode.AccessDenied.Code())
+		So(entry["caller"], ShouldEqual, "billing")
+		So(entry["system_id"], ShouldEqual, "1000")
+	})
+}
+
+type discardReporter struct{}
+
+func (discardReporter) WriteSpan(*trace.Span) error { return nil }
+func (discardReporter) Close() error                { return nil }
@@ -27,6 +27,13 @@ var (
 		Help:      "http server requests error count.",
 		Labels:    []string{"path", "caller", "method", "code"},
 	})
+	_metricServerCacheTotal = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: serverNamespace,
+		Subsystem: "cache",
+		Name:      "requests_total",
+		Help:      "http server response cache hit/miss/stale count.",
+		Labels:    []string{"path", "result"},
+	})
 )
 
 // 基于prometheus实现指标收集功能
@@ -0,0 +1,307 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aluka-7/metacode"
+	"github.com/golang/protobuf/proto"
+	"github.com/labstack/echo/v4"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	MIMEApplicationMsgpack  = "application/msgpack"
+	MIMEApplicationProtobuf = "application/x-protobuf"
+)
+
+// Codec 响应与请求体的编解码器,可通过RegisterCodec扩展.
+type Codec interface {
+	// ContentType 返回编解码器对应的媒体类型,例如"application/json"
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// CodecSupporter 编解码器可选实现的接口,用于判断能否编码v,不能编码时Respond继续协商下一个可接受的格式.
+type CodecSupporter interface {
+	Supports(v interface{}) bool
+}
+
+var codecs = struct {
+	sync.RWMutex
+	list []Codec
+}{list: []Codec{jsonCodec{}, xmlCodec{}, msgpackCodec{}, protobufCodec{}}}
+
+// RegisterCodec 注册编解码器,相同媒体类型的编解码器会被替换.
+// 注意:此方法不是线程安全的,因此应在处理请求之前注册.
+func RegisterCodec(c Codec) {
+	codecs.Lock()
+	defer codecs.Unlock()
+	for i, v := range codecs.list {
+		if v.ContentType() == c.ContentType() {
+			codecs.list[i] = c
+			return
+		}
+	}
+	codecs.list = append(codecs.list, c)
+}
+
+// Respond 根据请求头Accept协商响应格式并输出v,未指定Accept时使用JSON,
+// 跳过不能编码v的格式(例如v不是proto.Message时的protobuf),没有可接受的格式时返回406.
+func Respond(c echo.Context, status int, v interface{}) error {
+	for _, codec := range acceptableCodecs(c.Request().Header.Get(echo.HeaderAccept)) {
+		if s, ok := codec.(CodecSupporter); ok && !s.Supports(v) {
+			continue
+		}
+		return respondWith(c, codec, status, v)
+	}
+	return echo.NewHTTPError(http.StatusNotAcceptable)
+}
+
+func respondWith(c echo.Context, codec Codec, status int, v interface{}) error {
+	b, err := codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+	ct := codec.ContentType()
+	if strings.HasPrefix(ct, "text/") || ct == echo.MIMEApplicationJSON || ct == echo.MIMEApplicationXML {
+		ct += "; charset=UTF-8"
+	}
+	c.Response().Header().Add(echo.HeaderVary, echo.HeaderAccept)
+	return c.Blob(status, ct, b)
+}
+
+// 按照Accept中的q值依次匹配编解码器
+func negotiate(accept string) Codec {
+	if list := acceptableCodecs(accept); len(list) > 0 {
+		return list[0]
+	}
+	return nil
+}
+
+// 按Accept中的q值从高到低返回所有可接受的编解码器,未指定Accept时只返回JSON
+func acceptableCodecs(accept string) []Codec {
+	codecs.RLock()
+	defer codecs.RUnlock()
+	if len(accept) == 0 {
+		return codecs.list[:1]
+	}
+	var list []Codec
+	seen := make([]bool, len(codecs.list))
+	for _, r := range parseAccept(accept) {
+		for i, c := range codecs.list {
+			if !seen[i] && matchMediaRange(r, c.ContentType()) {
+				seen[i] = true
+				list = append(list, c)
+			}
+		}
+	}
+	return list
+}
+
+func codecFor(contentType string) Codec {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+	codecs.RLock()
+	defer codecs.RUnlock()
+	for _, c := range codecs.list {
+		if c.ContentType() == mt {
+			return c
+		}
+	}
+	return nil
+}
+
+// 解析Accept请求头,按q值从高到低排序,q=0的媒体类型被忽略
+func parseAccept(accept string) []string {
+	type mediaRange struct {
+		value string
+		q     float64
+	}
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, mediaRange{mt, q})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+	result := make([]string, len(ranges))
+	for i, r := range ranges {
+		result[i] = r.value
+	}
+	return result
+}
+
+func matchMediaRange(r, ct string) bool {
+	if r == "*/*" || r == ct {
+		return true
+	}
+	return strings.HasSuffix(r, "/*") && strings.HasPrefix(ct, r[:len(r)-1])
+}
+
+// Binder 根据Content-Type选择编解码器绑定请求体,JSON,XML和表单仍由echo默认实现处理.
+type Binder struct {
+	echo.DefaultBinder
+}
+
+func (b *Binder) Bind(i interface{}, c echo.Context) error {
+	req := c.Request()
+	codec := codecFor(req.Header.Get(echo.HeaderContentType))
+	if codec == nil {
+		return b.DefaultBinder.Bind(i, c)
+	}
+	switch codec.(type) {
+	case jsonCodec, xmlCodec:
+		return b.DefaultBinder.Bind(i, c)
+	}
+	if err := b.BindPathParams(c, i); err != nil {
+		return err
+	}
+	if req.Method == http.MethodGet || req.Method == http.MethodDelete || req.Method == http.MethodHead {
+		if err := b.BindQueryParams(c, i); err != nil {
+			return err
+		}
+	}
+	if req.ContentLength == 0 {
+		return nil
+	}
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+	}
+	if err = codec.Unmarshal(data, i); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+	}
+	return nil
+}
+
+// ErrorResponse 统一错误响应
+type ErrorResponse struct {
+	XMLName xml.Name `json:"-" msgpack:"-" xml:"error"`
+	Code    int      `json:"code" msgpack:"code" xml:"code"`
+	Message string   `json:"message" msgpack:"message" xml:"message"`
+}
+
+// HTTPErrorHandler 统一错误处理,响应格式与Respond一致,protobuf响应使用metacode的Status消息.
+func HTTPErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+	status, body := errorResponse(err)
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(status)
+	} else {
+		codec := negotiate(c.Request().Header.Get(echo.HeaderAccept))
+		if codec == nil {
+			codec = jsonCodec{}
+		}
+		var v interface{} = body
+		if _, ok := codec.(protobufCodec); ok {
+			v = metacode.Error(metacode.Code(body.Code), body.Message).Proto()
+		}
+		if err = respondWith(c, codec, status, v); err != nil {
+			err = respondWith(c, jsonCodec{}, status, body)
+		}
+	}
+	if err != nil {
+		c.Logger().Error(err)
+	}
+}
+
+// 将错误转换为HTTP状态码和错误响应:
+// echo.HTTPError使用其状态码;metacode错误码为-400~-599时使用对应状态码,校验错误为400,其余为500.
+func errorResponse(err error) (int, ErrorResponse) {
+	if he, ok := err.(*echo.HTTPError); ok {
+		if he.Internal != nil {
+			if herr, ok := he.Internal.(*echo.HTTPError); ok {
+				he = herr
+			}
+		}
+		return he.Code, ErrorResponse{Code: -he.Code, Message: fmt.Sprint(he.Message)}
+	}
+	cause := metacode.Cause(err)
+	code := cause.Code()
+	status := http.StatusInternalServerError
+	switch {
+	case code == -1 || code == metacode.ValidateErr.Code():
+		status = http.StatusBadRequest
+	case code <= -400 && code >= -599:
+		status = -code
+	}
+	return status, ErrorResponse{Code: code, Message: cause.Message()}
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string                        { return echo.MIMEApplicationJSON }
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+type xmlCodec struct{}
+
+func (xmlCodec) ContentType() string                        { return echo.MIMEApplicationXML }
+func (xmlCodec) Marshal(v interface{}) ([]byte, error)      { return xml.Marshal(v) }
+func (xmlCodec) Unmarshal(data []byte, v interface{}) error { return xml.Unmarshal(data, v) }
+
+// 没有msgpack标签的字段使用json标签,与JSON响应的字段名一致
+type msgpackCodec struct{}
+
+func (msgpackCodec) ContentType() string { return MIMEApplicationMsgpack }
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+type protobufCodec struct{}
+
+func (protobufCodec) ContentType() string { return MIMEApplicationProtobuf }
+func (protobufCodec) Supports(v interface{}) bool {
+	_, ok := v.(proto.Message)
+	return ok
+}
+func (protobufCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("protobuf: %T is not a proto.Message", v)
+	}
+	return proto.Marshal(m)
+}
+func (protobufCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("protobuf: %T is not a proto.Message", v)
+	}
+	return proto.Unmarshal(data, m)
+}
@@ -0,0 +1,92 @@
+package web_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aluka-7/metacode"
+	"github.com/aluka-7/metacode/types"
+	"github.com/aluka-7/web"
+	"github.com/golang/protobuf/proto"
+	"github.com/labstack/echo/v4"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+type pet struct {
+	Name string `json:"name" xml:"name" msgpack:"name"`
+}
+
+type owner struct {
+	FullName string `json:"full_name"`
+	Secret   string `json:"-"`
+}
+
+func TestRespond(t *testing.T) {
+	Convey("test Respond\n", t, func() {
+		e := echo.New()
+		e.Binder = &web.Binder{}
+		e.HTTPErrorHandler = web.HTTPErrorHandler
+		e.POST("/pets", func(c echo.Context) error {
+			var p pet
+			if err := c.Bind(&p); err != nil {
+				return err
+			}
+			return web.Respond(c, http.StatusOK, p)
+		})
+		e.GET("/owner", func(c echo.Context) error {
+			return web.Respond(c, http.StatusOK, owner{FullName: "tom", Secret: "x"})
+		})
+		e.GET("/fail", func(c echo.Context) error {
+			return metacode.AccessDenied
+		})
+		do := func(method, path, accept, ct string, body []byte) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, path, bytes.NewReader(body))
+			req.Header.Set(echo.HeaderAccept, accept)
+			req.Header.Set(echo.HeaderContentType, ct)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			return rec
+		}
+
+		body, _ := msgpack.Marshal(pet{Name: "tom"})
+		rec := do(http.MethodPost, "/pets", "application/xml;q=0.5, application/json", web.MIMEApplicationMsgpack, body)
+		So(rec.Code, ShouldEqual, http.StatusOK)
+		So(rec.Body.String(), ShouldEqual, `{"name":"tom"}`)
+
+		rec = do(http.MethodPost, "/pets", "application/*", echo.MIMEApplicationJSON, []byte(`{"name":"tom"}`))
+		So(rec.Body.String(), ShouldEqual, `{"name":"tom"}`)
+
+		rec = do(http.MethodPost, "/pets", web.MIMEApplicationMsgpack, echo.MIMEApplicationJSON, []byte(`{"name":"tom"}`))
+		var p pet
+		So(msgpack.Unmarshal(rec.Body.Bytes(), &p), ShouldBeNil)
+		So(p.Name, ShouldEqual, "tom")
+
+		rec = do(http.MethodPost, "/pets", "text/csv", echo.MIMEApplicationJSON, []byte(`{"name":"tom"}`))
+		So(rec.Code, ShouldEqual, http.StatusNotAcceptable)
+
+		// MessagePack与JSON使用相同的字段名
+		rec = do(http.MethodGet, "/owner", web.MIMEApplicationMsgpack, "", nil)
+		var m map[string]interface{}
+		So(msgpack.Unmarshal(rec.Body.Bytes(), &m), ShouldBeNil)
+		So(m, ShouldResemble, map[string]interface{}{"full_name": "tom"})
+
+		// 不能编码为protobuf时使用下一个可接受的格式,没有时返回406
+		rec = do(http.MethodGet, "/owner", web.MIMEApplicationProtobuf+", application/json;q=0.5", "", nil)
+		So(rec.Code, ShouldEqual, http.StatusOK)
+		So(rec.Body.String(), ShouldEqual, `{"full_name":"tom"}`)
+		rec = do(http.MethodGet, "/owner", web.MIMEApplicationProtobuf, "", nil)
+		So(rec.Code, ShouldEqual, http.StatusNotAcceptable)
+
+		rec = do(http.MethodGet, "/fail", echo.MIMEApplicationXML, "", nil)
+		So(rec.Code, ShouldEqual, http.StatusForbidden)
+		So(rec.Body.String(), ShouldContainSubstring, "<code>-403</code>")
+
+		rec = do(http.MethodGet, "/fail", web.MIMEApplicationProtobuf, "", nil)
+		var s types.Status
+		So(proto.Unmarshal(rec.Body.Bytes(), &s), ShouldBeNil)
+		So(s.Code, ShouldEqual, -403)
+	})
+}
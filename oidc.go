@@ -0,0 +1,406 @@
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	oidcStateKey    = "oidc.state"
+	oidcNonceKey    = "oidc.nonce"
+	oidcVerifierKey = "oidc.verifier"
+	oidcReturnKey   = "oidc.return"
+	oidcTokenKey    = "oidc.token"
+
+	// 访问令牌在过期前该时间内即刷新
+	oidcRefreshLeeway = 10 * time.Second
+)
+
+// OIDCConfig OpenID Connect登录配置
+type OIDCConfig struct {
+	Issuer       string   // 身份提供方地址,通过{Issuer}/.well-known/openid-configuration发现端点
+	ClientID     string   // 客户端ID
+	ClientSecret string   // 客户端密钥,为空时作为公开客户端仅使用PKCE
+	RedirectURL  string   // 回调地址的完整URL,路径需与CallbackPath一致
+	Scopes       []string // 默认为openid,profile,email
+
+	LoginPath     string // 登录地址,默认为"/auth/login",支持?return=登录后跳转的站内地址
+	CallbackPath  string // 回调地址,默认为"/auth/callback"
+	LogoutPath    string // 退出地址,默认为"/auth/logout"
+	PostLoginURL  string // 未指定return时登录后的跳转地址,默认为"/"
+	PostLogoutURL string // 退出后的跳转地址,需为完整URL才能传给身份提供方,默认为"/"
+
+	ClockSkew  time.Duration // 校验ID令牌时间时允许的偏差,默认1分钟
+	HTTPClient *http.Client  // 访问身份提供方的客户端,默认为http.DefaultClient
+}
+
+// OIDCToken 登录后保存在会话中的令牌
+type OIDCToken struct {
+	Subject      string                 `json:"sub"`
+	Claims       map[string]interface{} `json:"claims"` // ID令牌中的声明
+	IDToken      string                 `json:"idToken"`
+	AccessToken  string                 `json:"accessToken"`
+	RefreshToken string                 `json:"refreshToken,omitempty"`
+	Expiry       time.Time              `json:"expiry"`
+}
+
+// OIDC OpenID Connect依赖方,使用授权码模式及PKCE登录,登录状态保存在会话中,需要同时使用SessionWithConfig.
+// 令牌连同声明通常超过cookie的4KB限制,会话必须使用服务端存储,不支持NewCookieSessionStore.
+type OIDC struct {
+	config    OIDCConfig
+	discovery struct {
+		Issuer                string   `json:"issuer"`
+		AuthorizationEndpoint string   `json:"authorization_endpoint"`
+		TokenEndpoint         string   `json:"token_endpoint"`
+		JwksURI               string   `json:"jwks_uri"`
+		EndSessionEndpoint    string   `json:"end_session_endpoint"`
+		Algorithms            []string `json:"id_token_signing_alg_values_supported"`
+	}
+	keys   *JWTKeySet
+	parser *jwt.Parser
+}
+
+// NewOIDC 读取身份提供方的发现文档及签名密钥
+func NewOIDC(config OIDCConfig) (*OIDC, error) {
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "profile", "email"}
+	}
+	if len(config.LoginPath) == 0 {
+		config.LoginPath = "/auth/login"
+	}
+	if len(config.CallbackPath) == 0 {
+		config.CallbackPath = "/auth/callback"
+	}
+	if len(config.LogoutPath) == 0 {
+		config.LogoutPath = "/auth/logout"
+	}
+	if len(config.PostLoginURL) == 0 {
+		config.PostLoginURL = "/"
+	}
+	if len(config.PostLogoutURL) == 0 {
+		config.PostLogoutURL = "/"
+	}
+	if config.ClockSkew == 0 {
+		config.ClockSkew = time.Minute
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	o := &OIDC{config: config}
+	if err := o.getJSON(strings.TrimSuffix(config.Issuer, "/")+"/.well-known/openid-configuration", &o.discovery); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %v", err)
+	}
+	if o.discovery.Issuer != config.Issuer {
+		return nil, fmt.Errorf("oidc discovery: issuer mismatch %q", o.discovery.Issuer)
+	}
+	// 只接受身份提供方声明的签名算法,未声明时按规范默认为RS256
+	var algorithms []string
+	for _, alg := range o.discovery.Algorithms {
+		if alg != "none" {
+			algorithms = append(algorithms, alg)
+		}
+	}
+	if len(algorithms) == 0 {
+		algorithms = []string{"RS256"}
+	}
+	o.parser = jwt.NewParser(jwt.WithValidMethods(algorithms), jwt.WithoutClaimsValidation())
+	o.keys = new(JWTKeySet)
+	if err := o.loadKeys(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// Register 注册登录,回调及退出路由
+func (o *OIDC) Register(e *echo.Echo) {
+	e.GET(o.config.LoginPath, o.login)
+	e.GET(o.config.CallbackPath, o.callback)
+	e.GET(o.config.LogoutPath, o.logout)
+}
+
+// RequireLogin 要求已登录的中间件,未登录时跳转到登录地址;访问令牌即将过期时使用刷新令牌续期,
+// 续期失败视为未登录.登录用户作为当前请求的认证主体.
+func (o *OIDC) RequireLogin() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			token := OIDCUser(c)
+			if token != nil && time.Now().Add(oidcRefreshLeeway).After(token.Expiry) {
+				if err := o.refresh(c, token); err != nil {
+					c.Logger().Warnf("刷新令牌出错:%+v", err)
+					token = nil
+				}
+			}
+			if token == nil {
+				if c.Request().Method != http.MethodGet {
+					return echo.ErrUnauthorized
+				}
+				return c.Redirect(http.StatusFound, o.config.LoginPath+"?return="+url.QueryEscape(c.Request().RequestURI))
+			}
+			SetSubject(c, token.Subject)
+			return next(c)
+		}
+	}
+}
+
+// OIDCUser 返回会话中的登录信息,未登录时返回nil
+func OIDCUser(c echo.Context) *OIDCToken {
+	s := Session(c)
+	if s == nil {
+		return nil
+	}
+	v, _ := s.Get(oidcTokenKey).(string)
+	if len(v) == 0 {
+		return nil
+	}
+	token := new(OIDCToken)
+	if err := json.Unmarshal([]byte(v), token); err != nil {
+		return nil
+	}
+	return token
+}
+
+func (o *OIDC) login(c echo.Context) error {
+	s, err := oidcSession(c)
+	if err != nil {
+		return err
+	}
+	state, nonce, verifier := randomToken(), randomToken(), randomToken()
+	s.Set(oidcStateKey, state)
+	s.Set(oidcNonceKey, nonce)
+	s.Set(oidcVerifierKey, verifier)
+	s.Set(oidcReturnKey, localURL(c.QueryParam("return"), o.config.PostLoginURL))
+	challenge := sha256.Sum256([]byte(verifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {o.config.ClientID},
+		"redirect_uri":          {o.config.RedirectURL},
+		"scope":                 {strings.Join(o.config.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	return c.Redirect(http.StatusFound, o.discovery.AuthorizationEndpoint+"?"+q.Encode())
+}
+
+func (o *OIDC) callback(c echo.Context) error {
+	s, err := oidcSession(c)
+	if err != nil {
+		return err
+	}
+	state, _ := s.Get(oidcStateKey).(string)
+	nonce, _ := s.Get(oidcNonceKey).(string)
+	verifier, _ := s.Get(oidcVerifierKey).(string)
+	returnURL, _ := s.Get(oidcReturnKey).(string)
+	for _, k := range []string{oidcStateKey, oidcNonceKey, oidcVerifierKey, oidcReturnKey} {
+		s.Delete(k)
+	}
+	if e := c.QueryParam("error"); len(e) > 0 {
+		return echo.NewHTTPError(http.StatusUnauthorized, "oidc: "+e+" "+c.QueryParam("error_description"))
+	}
+	if len(state) == 0 || c.QueryParam("state") != state {
+		return echo.NewHTTPError(http.StatusBadRequest, "oidc: invalid state")
+	}
+	token, err := o.exchange(url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {c.QueryParam("code")},
+		"redirect_uri":  {o.config.RedirectURL},
+		"code_verifier": {verifier},
+	})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error()).SetInternal(err)
+	}
+	if err = o.verifyIDToken(token, nonce); err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error()).SetInternal(err)
+	}
+	// 登录后更换会话ID防止会话固定攻击
+	s.RotateID()
+	if err = saveOIDCToken(s, token); err != nil {
+		return err
+	}
+	return c.Redirect(http.StatusFound, localURL(returnURL, o.config.PostLoginURL))
+}
+
+// 令牌保存在cookie中会超出大小限制被浏览器丢弃,导致登录静默失败,因此拒绝cookie存储
+func oidcSession(c echo.Context) (*SessionData, error) {
+	s := Session(c)
+	if s == nil {
+		return nil, errors.New("oidc: session middleware is required")
+	}
+	if s.inCookie {
+		return nil, errors.New("oidc: cookie session store is not supported, use a server-side store")
+	}
+	return s, nil
+}
+
+func (o *OIDC) logout(c echo.Context) error {
+	target := o.config.PostLogoutURL
+	if s := Session(c); s != nil {
+		if token := OIDCUser(c); token != nil && len(o.discovery.EndSessionEndpoint) > 0 {
+			q := url.Values{"id_token_hint": {token.IDToken}, "client_id": {o.config.ClientID}}
+			if strings.Contains(o.config.PostLogoutURL, "://") {
+				q.Set("post_logout_redirect_uri", o.config.PostLogoutURL)
+			}
+			target = o.discovery.EndSessionEndpoint + "?" + q.Encode()
+		}
+		s.Destroy()
+	}
+	return c.Redirect(http.StatusFound, target)
+}
+
+func (o *OIDC) refresh(c echo.Context, token *OIDCToken) error {
+	if len(token.RefreshToken) == 0 {
+		return errors.New("oidc: token expired")
+	}
+	fresh, err := o.exchange(url.Values{"grant_type": {"refresh_token"}, "refresh_token": {token.RefreshToken}})
+	if err != nil {
+		return err
+	}
+	if len(fresh.IDToken) > 0 {
+		if err = o.verifyIDToken(fresh, ""); err != nil {
+			return err
+		}
+		if fresh.Subject != token.Subject {
+			return errors.New("oidc: subject changed on refresh")
+		}
+	} else {
+		fresh.IDToken, fresh.Subject, fresh.Claims = token.IDToken, token.Subject, token.Claims
+	}
+	if len(fresh.RefreshToken) == 0 {
+		fresh.RefreshToken = token.RefreshToken
+	}
+	*token = *fresh
+	return saveOIDCToken(Session(c), token)
+}
+
+func saveOIDCToken(s *SessionData, token *OIDCToken) error {
+	b, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	// 以JSON字符串保存,不依赖会话存储对值类型的处理
+	s.Set(oidcTokenKey, string(b))
+	return nil
+}
+
+// 调用令牌端点
+func (o *OIDC) exchange(form url.Values) (*OIDCToken, error) {
+	if len(o.config.ClientSecret) == 0 {
+		form.Set("client_id", o.config.ClientID)
+	}
+	req, err := http.NewRequest(http.MethodPost, o.discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	if len(o.config.ClientSecret) > 0 {
+		req.SetBasicAuth(url.QueryEscape(o.config.ClientID), url.QueryEscape(o.config.ClientSecret))
+	}
+	resp, err := o.config.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var r struct {
+		AccessToken      string `json:"access_token"`
+		RefreshToken     string `json:"refresh_token"`
+		IDToken          string `json:"id_token"`
+		ExpiresIn        int64  `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err = json.Unmarshal(body, &r); err != nil {
+		return nil, fmt.Errorf("oidc token: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || len(r.Error) > 0 {
+		return nil, fmt.Errorf("oidc token: %d %s %s", resp.StatusCode, r.Error, r.ErrorDescription)
+	}
+	token := &OIDCToken{AccessToken: r.AccessToken, RefreshToken: r.RefreshToken, IDToken: r.IDToken}
+	if r.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(r.ExpiresIn) * time.Second)
+	} else {
+		token.Expiry = time.Now().Add(time.Hour)
+	}
+	return token, nil
+}
+
+// 校验ID令牌的签名,签发方,受众,有效期及nonce,通过后填充Subject和Claims
+func (o *OIDC) verifyIDToken(token *OIDCToken, nonce string) error {
+	if len(token.IDToken) == 0 {
+		return errors.New("oidc: missing id_token")
+	}
+	claims := jwt.MapClaims{}
+	if _, err := o.parser.ParseWithClaims(token.IDToken, claims, o.keys.keyFunc); err != nil {
+		// 身份提供方可能已轮换密钥,重新加载后再试一次
+		if lerr := o.loadKeys(); lerr != nil {
+			return err
+		}
+		if _, err = o.parser.ParseWithClaims(token.IDToken, claims, o.keys.keyFunc); err != nil {
+			return fmt.Errorf("oidc id_token: %v", err)
+		}
+	}
+	var registered jwt.RegisteredClaims
+	if _, _, err := o.parser.ParseUnverified(token.IDToken, &registered); err != nil {
+		return err
+	}
+	conf := JWTConfig{Issuer: o.discovery.Issuer, Audience: []string{o.config.ClientID}, ClockSkew: o.config.ClockSkew}
+	if err := conf.verify(&registered, time.Now()); err != nil {
+		return fmt.Errorf("oidc id_token: %v", err)
+	}
+	if len(nonce) > 0 && claims["nonce"] != nonce {
+		return errors.New("oidc id_token: invalid nonce")
+	}
+	token.Subject, token.Claims = registered.Subject, claims
+	return nil
+}
+
+func (o *OIDC) loadKeys() error {
+	resp, err := o.config.HTTPClient.Get(o.discovery.JwksURI)
+	if err != nil {
+		return fmt.Errorf("oidc jwks: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("oidc jwks: %v", err)
+	}
+	if err = o.keys.Update(body); err != nil {
+		return fmt.Errorf("oidc jwks: %v", err)
+	}
+	return nil
+}
+
+func (o *OIDC) getJSON(u string, v interface{}) error {
+	resp, err := o.config.HTTPClient.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", u, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// 只允许跳转到站内地址,防止开放重定向
+func localURL(u, fallback string) string {
+	if !strings.HasPrefix(u, "/") || strings.HasPrefix(u, "//") || strings.HasPrefix(u, "/\\") {
+		return fallback
+	}
+	return u
+}
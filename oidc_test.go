@@ -0,0 +1,230 @@
+package web_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aluka-7/web"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/labstack/echo/v4"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// 测试用的身份提供方
+type stubIdP struct {
+	*httptest.Server
+	key      *rsa.PrivateKey
+	lock     sync.Mutex
+	codes    map[string]url.Values // 授权码对应的授权请求参数
+	refresh  int
+	lifetime int64
+	method   jwt.SigningMethod // ID令牌的签名算法
+}
+
+func newStubIdP() *stubIdP {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	idp := &stubIdP{key: key, codes: make(map[string]url.Values), lifetime: 3600, method: jwt.SigningMethodRS256}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+			"end_session_endpoint":   idp.URL + "/logout",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		b64 := base64.RawURLEncoding.EncodeToString
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "k1", "n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		idp.lock.Lock()
+		idp.codes["code-1"] = q
+		idp.lock.Unlock()
+		http.Redirect(w, r, q.Get("redirect_uri")+"?code=code-1&state="+url.QueryEscape(q.Get("state")), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if id != "console" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+		idp.lock.Lock()
+		defer idp.lock.Unlock()
+		var nonce string
+		switch r.PostFormValue("grant_type") {
+		case "authorization_code":
+			q, ok := idp.codes[r.PostFormValue("code")]
+			sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+			if !ok || q.Get("code_challenge") != base64.RawURLEncoding.EncodeToString(sum[:]) {
+				w.WriteHeader(http.StatusBadRequest)
+				_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+				return
+			}
+			delete(idp.codes, r.PostFormValue("code"))
+			nonce = q.Get("nonce")
+		case "refresh_token":
+			idp.refresh++
+		}
+		token := jwt.NewWithClaims(idp.method, jwt.MapClaims{
+			"iss": idp.URL, "aud": "console", "sub": "tom", "nonce": nonce, "name": "Tom",
+			"exp": time.Now().Add(time.Hour).Unix(),
+		})
+		token.Header["kid"] = "k1"
+		idToken, _ := token.SignedString(key)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "at", "refresh_token": "rt", "id_token": idToken, "expires_in": idp.lifetime,
+		})
+	})
+	idp.Server = httptest.NewServer(mux)
+	return idp
+}
+
+func TestOIDC(t *testing.T) {
+	Convey("test OIDC login flow\n", t, func() {
+		idp := newStubIdP()
+		defer idp.Close()
+		oidc, err := web.NewOIDC(web.OIDCConfig{
+			Issuer:        idp.URL,
+			ClientID:      "console",
+			ClientSecret:  "secret",
+			RedirectURL:   "http://console.example.com/auth/callback",
+			PostLogoutURL: "http://console.example.com/",
+		})
+		So(err, ShouldBeNil)
+
+		e := echo.New()
+		e.Use(web.SessionWithConfig(web.SessionConfig{Store: web.NewMemorySessionStore(time.Hour, 0)}))
+		oidc.Register(e)
+		e.GET("/admin", func(c echo.Context) error {
+			return c.String(http.StatusOK, web.Subject(c)+":"+web.OIDCUser(c).Claims["name"].(string))
+		}, oidc.RequireLogin())
+
+		var cookies []*http.Cookie
+		do := func(target string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, target, nil)
+			for _, c := range cookies {
+				req.AddCookie(c)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if cs := rec.Result().Cookies(); len(cs) > 0 {
+				cookies = cs
+			}
+			return rec
+		}
+		noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+		rec := do("/admin?tab=1")
+		So(rec.Code, ShouldEqual, http.StatusFound)
+		So(rec.Header().Get(echo.HeaderLocation), ShouldEqual, "/auth/login?return=%2Fadmin%3Ftab%3D1")
+
+		rec = do(rec.Header().Get(echo.HeaderLocation))
+		So(rec.Code, ShouldEqual, http.StatusFound)
+		authorize, _ := url.Parse(rec.Header().Get(echo.HeaderLocation))
+		So(authorize.Query().Get("code_challenge_method"), ShouldEqual, "S256")
+		So(authorize.Query().Get("nonce"), ShouldNotBeEmpty)
+
+		// state不匹配时拒绝,且state只能使用一次
+		So(do("/auth/callback?code=code-1&state=forged").Code, ShouldEqual, http.StatusBadRequest)
+		So(do("/auth/callback?code=code-1&state="+authorize.Query().Get("state")).Code, ShouldEqual, http.StatusBadRequest)
+
+		// 重新发起登录后使用正确的回调
+		rec = do("/auth/login?return=/admin")
+		authorize, _ = url.Parse(rec.Header().Get(echo.HeaderLocation))
+		resp, err := noRedirect.Get(authorize.String())
+		So(err, ShouldBeNil)
+		callback, _ := url.Parse(resp.Header.Get(echo.HeaderLocation))
+		rec = do(callback.RequestURI())
+		So(rec.Code, ShouldEqual, http.StatusFound)
+		So(rec.Header().Get(echo.HeaderLocation), ShouldEqual, "/admin")
+
+		rec = do("/admin")
+		So(rec.Code, ShouldEqual, http.StatusOK)
+		So(rec.Body.String(), ShouldEqual, "tom:Tom")
+		So(idp.refresh, ShouldEqual, 0)
+
+		// 令牌即将过期时自动刷新
+		idp.lifetime = 1
+		rec = do("/auth/login")
+		authorize, _ = url.Parse(rec.Header().Get(echo.HeaderLocation))
+		resp, _ = noRedirect.Get(authorize.String())
+		callback, _ = url.Parse(resp.Header.Get(echo.HeaderLocation))
+		So(do(callback.RequestURI()).Code, ShouldEqual, http.StatusFound)
+		idp.lifetime = 3600
+		So(do("/admin").Code, ShouldEqual, http.StatusOK)
+		So(do("/admin").Code, ShouldEqual, http.StatusOK)
+		So(idp.refresh, ShouldEqual, 1)
+
+		rec = do("/auth/logout")
+		So(rec.Code, ShouldEqual, http.StatusFound)
+		logout, _ := url.Parse(rec.Header().Get(echo.HeaderLocation))
+		So(logout.Path, ShouldEqual, "/logout")
+		So(logout.Query().Get("id_token_hint"), ShouldNotBeEmpty)
+		So(logout.Query().Get("post_logout_redirect_uri"), ShouldEqual, "http://console.example.com/")
+		So(do("/admin").Code, ShouldEqual, http.StatusFound)
+	})
+}
+
+func TestOIDCRestrictions(t *testing.T) {
+	Convey("test OIDC signing algorithms and session store\n", t, func() {
+		idp := newStubIdP()
+		defer idp.Close()
+		oidc, err := web.NewOIDC(web.OIDCConfig{
+			Issuer:       idp.URL,
+			ClientID:     "console",
+			ClientSecret: "secret",
+			RedirectURL:  "http://console.example.com/auth/callback",
+		})
+		So(err, ShouldBeNil)
+		noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+		login := func(e *echo.Echo) int {
+			req := httptest.NewRequest(http.MethodGet, "/auth/login", nil)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != http.StatusFound {
+				return rec.Code
+			}
+			resp, err := noRedirect.Get(rec.Header().Get(echo.HeaderLocation))
+			So(err, ShouldBeNil)
+			callback, _ := url.Parse(resp.Header.Get(echo.HeaderLocation))
+			req = httptest.NewRequest(http.MethodGet, callback.RequestURI(), nil)
+			for _, c := range rec.Result().Cookies() {
+				req.AddCookie(c)
+			}
+			rec = httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			return rec.Code
+		}
+
+		// 发现文档未声明算法时只接受RS256
+		e := echo.New()
+		e.Use(web.SessionWithConfig(web.SessionConfig{Store: web.NewMemorySessionStore(time.Hour, 0)}))
+		oidc.Register(e)
+		idp.method = jwt.SigningMethodRS512
+		So(login(e), ShouldEqual, http.StatusUnauthorized)
+		idp.method = jwt.SigningMethodRS256
+		So(login(e), ShouldEqual, http.StatusFound)
+
+		// cookie存储无法容纳令牌,直接拒绝
+		e = echo.New()
+		e.Use(web.SessionWithConfig(web.SessionConfig{Store: web.NewCookieSessionStore(make([]byte, 32), nil)}))
+		oidc.Register(e)
+		So(login(e), ShouldEqual, http.StatusInternalServerError)
+	})
+}
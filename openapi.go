@@ -0,0 +1,450 @@
+package web
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v4"
+)
+
+// DocConfig 接口文档配置
+type DocConfig struct {
+	Enable      bool              `json:"enable"`      // 是否开启接口文档,默认关闭,生产环境不要开启
+	Title       string            `json:"title"`       // 文档标题,默认为systemId
+	Version     string            `json:"version"`     // 文档版本,默认为"1.0"
+	Description string            `json:"description"` // 文档描述
+	Path        string            `json:"path"`        // 文档路径前缀,默认为"/doc"
+	Spec        string            `json:"spec"`        // 外部OpenAPI文档文件(json或yaml),为空时使用根据路由生成的文档
+	SwaggerUI   string            `json:"swaggerUi"`   // swagger-ui-dist静态资源地址,默认使用内嵌的资源
+	Redoc       string            `json:"redoc"`       // redoc脚本地址,默认使用内嵌的资源
+	Users       map[string]string `json:"users"`       // Basic认证的用户名和密码,为空时不认证
+	AllowIPs    []string          `json:"allowIps"`    // 允许访问的IP或CIDR,为空时不限制
+}
+
+// OpenAPI OpenAPI 3 文档
+type OpenAPI struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       OpenAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*OpenAPIOperation `json:"paths"`
+	Components OpenAPIComponents                       `json:"components"`
+}
+
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type OpenAPIComponents struct {
+	Schemas map[string]*OpenAPISchema `json:"schemas,omitempty"`
+}
+
+type OpenAPIOperation struct {
+	OperationID string                      `json:"operationId,omitempty"`
+	Summary     string                      `json:"summary,omitempty"`
+	Description string                      `json:"description,omitempty"`
+	Tags        []string                    `json:"tags,omitempty"`
+	Parameters  []*OpenAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*OpenAPIResponse `json:"responses"`
+}
+
+type OpenAPIParameter struct {
+	Name     string         `json:"name"`
+	In       string         `json:"in"` // path,query,header
+	Required bool           `json:"required,omitempty"`
+	Schema   *OpenAPISchema `json:"schema"`
+}
+
+type OpenAPIRequestBody struct {
+	Required bool                         `json:"required,omitempty"`
+	Content  map[string]*OpenAPIMediaType `json:"content"`
+}
+
+type OpenAPIResponse struct {
+	Description string                       `json:"description"`
+	Content     map[string]*OpenAPIMediaType `json:"content,omitempty"`
+}
+
+type OpenAPIMediaType struct {
+	Schema *OpenAPISchema `json:"schema"`
+}
+
+// OpenAPISchema JSON Schema的子集,validate标签中的required,min,max,oneof,email会映射为对应约束.
+type OpenAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Properties           map[string]*OpenAPISchema `json:"properties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	Items                *OpenAPISchema            `json:"items,omitempty"`
+	AdditionalProperties *OpenAPISchema            `json:"additionalProperties,omitempty"`
+	Enum                 []interface{}             `json:"enum,omitempty"`
+	Minimum              *float64                  `json:"minimum,omitempty"`
+	Maximum              *float64                  `json:"maximum,omitempty"`
+	MinLength            *uint64                   `json:"minLength,omitempty"`
+	MaxLength            *uint64                   `json:"maxLength,omitempty"`
+	MinItems             *uint64                   `json:"minItems,omitempty"`
+	MaxItems             *uint64                   `json:"maxItems,omitempty"`
+}
+
+// Doc 设置接口摘要和分组标签.
+func (s *RouteSpec) Doc(summary string, tags ...string) *RouteSpec {
+	s.summary = summary
+	s.tags = append(s.tags, tags...)
+	return s
+}
+
+// Request 声明请求结构体,param/query/header标签的字段生成参数,其余字段生成JSON请求体.
+func (s *RouteSpec) Request(v interface{}) *RouteSpec {
+	s.request = v
+	return s
+}
+
+// Response 声明指定状态码的响应结构体,v为nil时表示无响应体.
+func (s *RouteSpec) Response(status int, v interface{}) *RouteSpec {
+	if s.responses == nil {
+		s.responses = make(map[int]interface{})
+	}
+	s.responses[status] = v
+	return s
+}
+
+// NewOpenAPI 根据已注册的路由以及通过Describe声明的请求响应类型生成OpenAPI 3文档.
+func NewOpenAPI(eng *echo.Echo, info OpenAPIInfo) *OpenAPI {
+	doc := &OpenAPI{
+		OpenAPI:    "3.0.3",
+		Info:       info,
+		Paths:      make(map[string]map[string]*OpenAPIOperation),
+		Components: OpenAPIComponents{Schemas: make(map[string]*OpenAPISchema)},
+	}
+	placeholder := funcName(echo.NotFoundHandler)
+	for _, r := range eng.Routes() {
+		if r.Name == placeholder || r.Name == docRouteName {
+			continue
+		}
+		path, params := openAPIPath(r.Path)
+		op := &OpenAPIOperation{Parameters: params, Responses: make(map[string]*OpenAPIResponse)}
+		if s := lookupRouteSpec(eng, r.Method, r.Path); s != nil {
+			if r.Name != s.Handler {
+				op.OperationID = r.Name
+			}
+			op.Summary, op.Tags = s.summary, s.tags
+			if s.request != nil {
+				doc.requestOf(op, r.Method, reflect.TypeOf(s.request))
+			}
+			for status, v := range s.responses {
+				res := &OpenAPIResponse{Description: http.StatusText(status)}
+				if v != nil {
+					res.Content = map[string]*OpenAPIMediaType{
+						echo.MIMEApplicationJSON: {Schema: doc.schemaOf(reflect.TypeOf(v))},
+					}
+				}
+				op.Responses[strconv.Itoa(status)] = res
+			}
+		}
+		if len(op.Responses) == 0 {
+			op.Responses["200"] = &OpenAPIResponse{Description: http.StatusText(http.StatusOK)}
+		}
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(map[string]*OpenAPIOperation)
+		}
+		doc.Paths[path][strings.ToLower(r.Method)] = op
+	}
+	return doc
+}
+
+// OpenAPIHandler 返回OpenAPI文档接口,文档在首次请求时生成.
+func OpenAPIHandler(info OpenAPIInfo) echo.HandlerFunc {
+	var once sync.Once
+	var doc *OpenAPI
+	return func(c echo.Context) error {
+		once.Do(func() { doc = NewOpenAPI(c.Echo(), info) })
+		return c.JSON(http.StatusOK, doc)
+	}
+}
+
+func openAPIInfo(systemId string, doc DocConfig) OpenAPIInfo {
+	info := OpenAPIInfo{Title: doc.Title, Version: doc.Version, Description: doc.Description}
+	if len(info.Title) == 0 {
+		info.Title = systemId
+	}
+	if len(info.Version) == 0 {
+		info.Version = "1.0"
+	}
+	return info
+}
+
+// 将echo路径转换为OpenAPI路径:"/users/:id"->"/users/{id}","/files/*"->"/files/{path}"
+func openAPIPath(p string) (string, []*OpenAPIParameter) {
+	var params []*OpenAPIParameter
+	segments := strings.Split(p, "/")
+	for i, s := range segments {
+		name := ""
+		switch {
+		case strings.HasPrefix(s, ":"):
+			name = s[1:]
+		case s == "*":
+			name = "path"
+		default:
+			continue
+		}
+		segments[i] = "{" + name + "}"
+		params = append(params, &OpenAPIParameter{Name: name, In: "path", Required: true, Schema: &OpenAPISchema{Type: "string"}})
+	}
+	return strings.Join(segments, "/"), params
+}
+
+func (doc *OpenAPI) requestOf(op *OpenAPIOperation, method string, t reflect.Type) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		op.RequestBody = &OpenAPIRequestBody{Required: true, Content: map[string]*OpenAPIMediaType{
+			echo.MIMEApplicationJSON: {Schema: doc.schemaOf(t)},
+		}}
+		return
+	}
+	body := &OpenAPISchema{Type: "object", Properties: make(map[string]*OpenAPISchema)}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		in, name := "", ""
+		for _, tag := range []string{"param", "query", "header"} {
+			if v := f.Tag.Get(tag); v != "" {
+				in, name = tag, v
+				break
+			}
+		}
+		schema := doc.schemaOf(f.Type)
+		required := applyValidateTag(schema, f.Type, f.Tag.Get("validate"))
+		if in != "" {
+			if in == "param" {
+				in = "path"
+				// 路由模式中已生成的路径参数以结构体中的定义为准
+				for _, p := range op.Parameters {
+					if p.In == in && p.Name == name {
+						p.Schema = schema
+					}
+				}
+				continue
+			}
+			op.Parameters = append(op.Parameters, &OpenAPIParameter{Name: name, In: in, Required: required, Schema: schema})
+			continue
+		}
+		name = jsonName(f)
+		if name == "-" {
+			continue
+		}
+		body.Properties[name] = schema
+		if required {
+			body.Required = append(body.Required, name)
+		}
+	}
+	sort.Strings(body.Required)
+	if len(body.Properties) > 0 && method != http.MethodGet && method != http.MethodDelete && method != http.MethodHead {
+		op.RequestBody = &OpenAPIRequestBody{Required: true, Content: map[string]*OpenAPIMediaType{
+			echo.MIMEApplicationJSON: {Schema: body},
+		}}
+	}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// 生成类型对应的schema,具名结构体放入components中并以$ref引用.
+func (doc *OpenAPI) schemaOf(t reflect.Type) *OpenAPISchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return &OpenAPISchema{Type: "string", Format: "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &OpenAPISchema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &OpenAPISchema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return &OpenAPISchema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &OpenAPISchema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &OpenAPISchema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &OpenAPISchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &OpenAPISchema{Type: "string", Format: "byte"}
+		}
+		return &OpenAPISchema{Type: "array", Items: doc.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &OpenAPISchema{Type: "object", AdditionalProperties: doc.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if name := schemaName(t); name != "" {
+			ref := &OpenAPISchema{Ref: "#/components/schemas/" + name}
+			if _, ok := doc.Components.Schemas[name]; ok {
+				return ref
+			}
+			// 先占位,避免递归结构体无限展开
+			doc.Components.Schemas[name] = &OpenAPISchema{}
+			*doc.Components.Schemas[name] = *doc.structSchema(t)
+			return ref
+		}
+		return doc.structSchema(t)
+	}
+	return &OpenAPISchema{}
+}
+
+// components中的schema名称,使用包路径限定,避免不同包的同名类型相互覆盖,
+// 例如github.com.aluka-7.web.OpenAPIInfo
+func schemaName(t reflect.Type) string {
+	if t.Name() == "" || t.PkgPath() == "" {
+		return t.Name()
+	}
+	// 名称只能包含字母,数字及"._-"
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '/':
+			return '.'
+		case r == '.' || r == '-' || r == '_' || r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			return r
+		}
+		return '_'
+	}, t.PkgPath()+"."+t.Name())
+}
+
+func (doc *OpenAPI) structSchema(t reflect.Type) *OpenAPISchema {
+	s := &OpenAPISchema{Type: "object", Properties: make(map[string]*OpenAPISchema)}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		// 与encoding/json一致,只展开嵌入的结构体,其他嵌入类型按普通字段处理
+		if f.Anonymous && f.Tag.Get("json") == "" && indirectType(f.Type).Kind() == reflect.Struct {
+			embedded := doc.structSchema(indirectType(f.Type))
+			for k, v := range embedded.Properties {
+				s.Properties[k] = v
+			}
+			s.Required = append(s.Required, embedded.Required...)
+			continue
+		}
+		name := jsonName(f)
+		if name == "-" {
+			continue
+		}
+		fs := doc.schemaOf(f.Type)
+		if applyValidateTag(fs, f.Type, f.Tag.Get("validate")) {
+			s.Required = append(s.Required, name)
+		}
+		s.Properties[name] = fs
+	}
+	sort.Strings(s.Required)
+	return s
+}
+
+// 将validate标签映射为schema约束,返回字段是否必填.
+func applyValidateTag(s *OpenAPISchema, t reflect.Type, tag string) (required bool) {
+	if tag == "" || s.Ref != "" {
+		// 引用的schema不附加约束,只判断是否必填,required_if等条件必填不算
+		for _, rule := range strings.Split(tag, ",") {
+			if rule == "dive" {
+				break
+			}
+			if rule == "required" {
+				return true
+			}
+		}
+		return false
+	}
+	kind := indirectType(t).Kind()
+	for _, rule := range strings.Split(tag, ",") {
+		name, value := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			name, value = rule[:i], rule[i+1:]
+		}
+		switch name {
+		case "dive":
+			// dive之后的规则作用于元素
+			return
+		case "required":
+			required = true
+		case "email":
+			s.Format = "email"
+		case "min", "max":
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			setBound(s, kind, name == "min", n)
+		case "oneof":
+			for _, v := range strings.Fields(value) {
+				s.Enum = append(s.Enum, enumValue(kind, v))
+			}
+		}
+	}
+	return
+}
+
+func setBound(s *OpenAPISchema, kind reflect.Kind, min bool, n float64) {
+	u := uint64(n)
+	switch kind {
+	case reflect.String:
+		if min {
+			s.MinLength = &u
+		} else {
+			s.MaxLength = &u
+		}
+	case reflect.Slice, reflect.Array, reflect.Map:
+		if min {
+			s.MinItems = &u
+		} else {
+			s.MaxItems = &u
+		}
+	default:
+		if min {
+			s.Minimum = &n
+		} else {
+			s.Maximum = &n
+		}
+	}
+}
+
+func enumValue(kind reflect.Kind, v string) interface{} {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return n
+		}
+	case reflect.Float32, reflect.Float64:
+		if n, err := strconv.ParseFloat(v, 64); err == nil {
+			return n
+		}
+	}
+	return v
+}
+
+func jsonName(f reflect.StructField) string {
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
@@ -0,0 +1,126 @@
+package web_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/aluka-7/web"
+	"github.com/labstack/echo/v4"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type createUser struct {
+	Org   string   `param:"org"`
+	Trace string   `header:"X-Trace"`
+	Name  string   `json:"name" validate:"required,min=2,max=20"`
+	Email string   `json:"email" validate:"required,email"`
+	Role  string   `json:"role" validate:"oneof=admin user"`
+	Age   int      `json:"age" validate:"min=18"`
+	Tags  []string `json:"tags" validate:"max=5,dive,min=1"`
+	Owner user     `json:"owner" validate:"required_with=Role"`
+	Admin *user    `json:"admin" validate:"required"`
+}
+
+// 与web.OpenAPIInfo同名
+type OpenAPIInfo struct {
+	Owner string `json:"owner"`
+}
+
+type Nickname string
+
+type profile struct {
+	Nickname
+	Bio string `json:"bio"`
+}
+
+type user struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestNewOpenAPI(t *testing.T) {
+	Convey("test NewOpenAPI\n", t, func() {
+		e := echo.New()
+		h := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+		web.Describe(e, e.POST("/orgs/:org/users", h)).Doc("创建用户", "user").
+			Request(createUser{}).Response(http.StatusCreated, user{})
+
+		doc := web.NewOpenAPI(e, web.OpenAPIInfo{Title: "test", Version: "1.0"})
+		op := doc.Paths["/orgs/{org}/users"]["post"]
+		So(op, ShouldNotBeNil)
+		So(op.Summary, ShouldEqual, "创建用户")
+		So(len(op.Parameters), ShouldEqual, 2)
+		So(op.Responses["201"].Content["application/json"].Schema.Ref, ShouldEqual, "#/components/schemas/github.com.aluka-7.web_test.user")
+
+		body := op.RequestBody.Content["application/json"].Schema
+		So(body.Required, ShouldResemble, []string{"admin", "email", "name"})
+		So(*body.Properties["name"].MinLength, ShouldEqual, 2)
+		So(*body.Properties["name"].MaxLength, ShouldEqual, 20)
+		So(body.Properties["email"].Format, ShouldEqual, "email")
+		So(body.Properties["role"].Enum, ShouldResemble, []interface{}{"admin", "user"})
+		So(*body.Properties["age"].Minimum, ShouldEqual, 18)
+		So(*body.Properties["tags"].MaxItems, ShouldEqual, 5)
+
+		// 不同包的同名类型不会相互覆盖,嵌入的非结构体类型按普通字段处理
+		web.Describe(e, e.GET("/infos", h)).Response(http.StatusOK, web.OpenAPIInfo{})
+		web.Describe(e, e.GET("/local-infos", h)).Response(http.StatusOK, OpenAPIInfo{})
+		web.Describe(e, e.GET("/profiles", h)).Response(http.StatusOK, profile{})
+		doc = web.NewOpenAPI(e, web.OpenAPIInfo{Title: "test", Version: "1.0"})
+		So(doc.Components.Schemas, ShouldContainKey, "github.com.aluka-7.web_test.user")
+		So(doc.Components.Schemas["github.com.aluka-7.web.OpenAPIInfo"].Properties, ShouldContainKey, "title")
+		So(doc.Components.Schemas["github.com.aluka-7.web_test.OpenAPIInfo"].Properties, ShouldContainKey, "owner")
+		p := doc.Components.Schemas["github.com.aluka-7.web_test.profile"]
+		So(p.Properties["Nickname"].Type, ShouldEqual, "string")
+		So(p.Properties["bio"].Type, ShouldEqual, "string")
+	})
+}
+
+func TestRegisterDoc(t *testing.T) {
+	Convey("test RegisterDoc\n", t, func() {
+		e := echo.New()
+		e.GET("/users", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+		web.RegisterDoc(e, web.DocConfig{Path: "/api-doc", Users: map[string]string{"doc": "secret"}},
+			web.OpenAPIInfo{Title: "test", Version: "1.0"}, nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/api-doc/swagger", nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		So(rec.Code, ShouldEqual, http.StatusUnauthorized)
+
+		req = httptest.NewRequest(http.MethodGet, "/api-doc/swagger", nil)
+		req.SetBasicAuth("doc", "secret")
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		So(rec.Code, ShouldEqual, http.StatusOK)
+		So(rec.Body.String(), ShouldContainSubstring, "openapi.json")
+		So(rec.Body.String(), ShouldNotContainSubstring, "cdn.jsdelivr.net")
+		So(rec.Body.String(), ShouldNotContainSubstring, "<script>")
+
+		// 内嵌的前端资源,带指纹长期缓存并返回预压缩的内容
+		bundle := regexp.MustCompile(`/api-doc/assets/swagger-ui/swagger-ui-bundle\.[0-9a-f]+\.js`).FindString(rec.Body.String())
+		So(bundle, ShouldNotBeEmpty)
+		req = httptest.NewRequest(http.MethodGet, bundle, nil)
+		req.SetBasicAuth("doc", "secret")
+		req.Header.Set(echo.HeaderAcceptEncoding, "gzip")
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		So(rec.Code, ShouldEqual, http.StatusOK)
+		So(rec.Header().Get(echo.HeaderContentEncoding), ShouldEqual, "gzip")
+		So(rec.Header().Get("Cache-Control"), ShouldEqual, "public, max-age=31536000, immutable")
+		req = httptest.NewRequest(http.MethodGet, "/api-doc/assets/swagger-init.js", nil)
+		req.SetBasicAuth("doc", "secret")
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		So(rec.Body.String(), ShouldContainSubstring, "SwaggerUIBundle")
+
+		req = httptest.NewRequest(http.MethodGet, "/api-doc/openapi.json", nil)
+		req.SetBasicAuth("doc", "secret")
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		So(rec.Code, ShouldEqual, http.StatusOK)
+		So(rec.Body.String(), ShouldContainSubstring, `"/users"`)
+		So(rec.Body.String(), ShouldNotContainSubstring, "/api-doc")
+	})
+}
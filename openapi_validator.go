@@ -0,0 +1,192 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/aluka-7/metacode"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// OpenAPIValidatorConfig 基于OpenAPI文档的请求校验配置
+type OpenAPIValidatorConfig struct {
+	// Skipper defines a function to skip middleware.
+	Skipper middleware.Skipper
+
+	// Spec OpenAPI文档文件(json或yaml)
+	Spec string
+
+	// BasePath 路由相对文档中paths的公共前缀,例如文档servers中定义的"/api/v1"
+	BasePath string
+
+	// ValidateResponse 是否校验响应,需要缓存整个响应体,仅建议在开发环境开启
+	ValidateResponse bool
+
+	// AllowUndefined 为true时文档中未定义的路由不做校验,否则返回校验错误
+	AllowUndefined bool
+
+	// Options 透传给openapi3filter的校验选项
+	Options openapi3filter.Options
+}
+
+// OpenAPIValidator 根据OpenAPI文档校验请求的路径参数,查询参数,请求头以及JSON请求体,
+// 校验失败时返回与表单校验一致的metacode错误.
+func OpenAPIValidator(config OpenAPIValidatorConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromFile(config.Spec)
+	if err != nil {
+		panic("加载OpenAPI文档出错:" + err.Error())
+	}
+	if err = doc.Validate(context.Background()); err != nil {
+		panic("OpenAPI文档格式错误:" + err.Error())
+	}
+	if config.Options.AuthenticationFunc == nil {
+		// 认证交给认证中间件处理
+		config.Options.AuthenticationFunc = openapi3filter.NoopAuthenticationFunc
+	}
+	config.BasePath = strings.TrimSuffix(config.BasePath, "/")
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+			route, params := findOpenAPIRoute(doc, config.BasePath, c)
+			if route == nil {
+				if config.AllowUndefined {
+					return next(c)
+				}
+				return validateError(routers.ErrPathNotFound)
+			}
+			req := c.Request()
+			input := &openapi3filter.RequestValidationInput{
+				Request:    req,
+				PathParams: params,
+				Route:      route,
+				Options:    &config.Options,
+			}
+			if err := openapi3filter.ValidateRequest(req.Context(), input); err != nil {
+				return validateError(err)
+			}
+			if !config.ValidateResponse {
+				return next(c)
+			}
+
+			res := c.Response()
+			dump := &bodyDumpWriter{ResponseWriter: res.Writer, buffered: true}
+			res.Writer = dump
+			err := next(c)
+			res.Writer = dump.ResponseWriter
+			if err != nil {
+				return err
+			}
+			output := &openapi3filter.ResponseValidationInput{
+				RequestValidationInput: input,
+				Status:                 res.Status,
+				Header:                 res.Header(),
+				Options:                &config.Options,
+			}
+			if verr := openapi3filter.ValidateResponse(req.Context(), output.SetBodyBytes(dump.body.Bytes())); verr != nil {
+				// 响应尚未真正写出,重置后交由错误处理器输出
+				res.Committed, res.Size = false, 0
+				return validateError(verr)
+			}
+			return dump.flush()
+		}
+	}
+}
+
+// 根据echo匹配到的路由在文档中查找对应的操作,路径参数按位置对应文档中的参数名.
+func findOpenAPIRoute(doc *openapi3.T, basePath string, c echo.Context) (*routers.Route, map[string]string) {
+	p := c.Path()
+	if len(basePath) > 0 {
+		if !strings.HasPrefix(p, basePath) {
+			return nil, nil
+		}
+		p = p[len(basePath):]
+	}
+	path, _ := openAPIPath(p)
+	item := doc.Paths.Find(path)
+	if item == nil {
+		return nil, nil
+	}
+	method := c.Request().Method
+	op := item.GetOperation(method)
+	if op == nil {
+		return nil, nil
+	}
+	// 文档中的路径可能使用不同的参数名,按出现顺序对应echo中的参数值
+	var specPath string
+	for k, v := range doc.Paths {
+		if v == item {
+			specPath = k
+		}
+	}
+	params := make(map[string]string)
+	values := c.ParamValues()
+	i := 0
+	for _, segment := range strings.Split(specPath, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") && i < len(values) {
+			params[strings.Trim(segment, "{}")] = values[i]
+			i++
+		}
+	}
+	return &routers.Route{Spec: doc, Path: specPath, PathItem: item, Method: method, Operation: op}, params
+}
+
+func validateError(err error) error {
+	return metacode.Errorf(-1, "validator error[%s]", err)
+}
+
+// bodyDumpWriter 记录写出的响应体,buffered为true时暂不写出,需要调用flush.
+type bodyDumpWriter struct {
+	http.ResponseWriter
+	body     bytes.Buffer
+	status   int
+	buffered bool
+}
+
+func (w *bodyDumpWriter) WriteHeader(code int) {
+	w.status = code
+	if !w.buffered {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *bodyDumpWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(b)
+	if w.buffered {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyDumpWriter) Flush() {
+	if !w.buffered {
+		if f, ok := w.ResponseWriter.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+}
+
+// 将缓存的响应写出
+func (w *bodyDumpWriter) flush() error {
+	if w.status == 0 {
+		return nil
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	_, err := w.ResponseWriter.Write(w.body.Bytes())
+	return err
+}
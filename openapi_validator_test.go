@@ -0,0 +1,118 @@
+package web_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aluka-7/web"
+	"github.com/labstack/echo/v4"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const validatorSpec = `openapi: 3.0.0
+info: {title: test, version: "1.0"}
+paths:
+  /users/{id}:
+    post:
+      parameters:
+        - {name: id, in: path, required: true, schema: {type: integer}}
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              type: object
+              required: [name]
+              properties:
+                name: {type: string, minLength: 2}
+      responses:
+        "200":
+          description: ok
+          content:
+            application/json:
+              schema:
+                type: object
+                required: [id]
+                properties:
+                  id: {type: integer}
+`
+
+func TestOpenAPIValidator(t *testing.T) {
+	Convey("test OpenAPIValidator middleware\n", t, func() {
+		spec := filepath.Join(t.TempDir(), "openapi.yaml")
+		So(ioutil.WriteFile(spec, []byte(validatorSpec), 0644), ShouldBeNil)
+
+		e := echo.New()
+		e.HTTPErrorHandler = web.HTTPErrorHandler
+		e.Use(web.OpenAPIValidator(web.OpenAPIValidatorConfig{
+			Spec:             spec,
+			BasePath:         "/api",
+			ValidateResponse: true,
+			Skipper: func(c echo.Context) bool {
+				return c.Path() == "/api/internal"
+			},
+		}))
+		e.POST("/api/users/:uid", func(c echo.Context) error {
+			var body struct {
+				Name string `json:"name"`
+			}
+			if err := c.Bind(&body); err != nil {
+				return err
+			}
+			if body.Name == "broken" {
+				// 不符合文档的响应
+				return c.JSON(http.StatusOK, map[string]string{"id": "x"})
+			}
+			return c.JSON(http.StatusOK, map[string]interface{}{"id": 1, "name": body.Name})
+		})
+		e.POST("/api/internal", func(c echo.Context) error {
+			return c.String(http.StatusOK, "internal")
+		})
+		e.POST("/api/undefined", func(c echo.Context) error {
+			return c.String(http.StatusOK, "undefined")
+		})
+		do := func(target, body string) (*httptest.ResponseRecorder, web.ErrorResponse) {
+			req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			var res web.ErrorResponse
+			if rec.Code != http.StatusOK {
+				So(json.Unmarshal(rec.Body.Bytes(), &res), ShouldBeNil)
+			}
+			return rec, res
+		}
+
+		rec, _ := do("/api/users/1", `{"name":"tom"}`)
+		So(rec.Code, ShouldEqual, http.StatusOK)
+		So(rec.Body.String(), ShouldEqual, `{"id":1,"name":"tom"}`+"\n")
+
+		// 请求体及路径参数不符合文档
+		rec, res := do("/api/users/1", `{"name":"t"}`)
+		So(rec.Code, ShouldEqual, http.StatusBadRequest)
+		So(res.Code, ShouldEqual, -1)
+		So(res.Message, ShouldStartWith, "validator error")
+		So(res.Message, ShouldContainSubstring, "name")
+		rec, res = do("/api/users/tom", `{"name":"tom"}`)
+		So(rec.Code, ShouldEqual, http.StatusBadRequest)
+		So(res.Code, ShouldEqual, -1)
+
+		// 响应不符合文档时丢弃已缓存的响应,只输出错误
+		rec, res = do("/api/users/1", `{"name":"broken"}`)
+		So(rec.Code, ShouldEqual, http.StatusBadRequest)
+		So(res.Code, ShouldEqual, -1)
+		So(rec.Body.String(), ShouldNotContainSubstring, `"id":"x"`)
+
+		// 跳过的路由及文档中未定义的路由
+		rec, _ = do("/api/internal", `{}`)
+		So(rec.Body.String(), ShouldEqual, "internal")
+		rec, res = do("/api/undefined", `{}`)
+		So(rec.Code, ShouldEqual, http.StatusBadRequest)
+		So(res.Code, ShouldEqual, -1)
+	})
+}
@@ -0,0 +1,150 @@
+package web
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pires/go-proxyproto"
+)
+
+const HeaderForwarded = "Forwarded"
+
+// TrustedProxyIPExtractor 返回客户端IP提取器:只有直连地址属于受信任代理时才读取转发信息,
+// header为代理实际设置的转发头,只读取该头:Forwarded(RFC 7239),X-Forwarded-For(默认)或X-Real-IP,
+// 其余转发头可能由客户端伪造,一律忽略.从右向左跳过受信任代理,返回第一个不受信任的地址.
+// trusted为空时始终使用直连地址.
+func TrustedProxyIPExtractor(trusted []string, header string) echo.IPExtractor {
+	nets := parseCIDRs(trusted)
+	header = http.CanonicalHeaderKey(header)
+	switch header {
+	case "":
+		header = echo.HeaderXForwardedFor
+	case HeaderForwarded, echo.HeaderXForwardedFor, echo.HeaderXRealIP:
+	default:
+		panic("unsupported proxy header " + header)
+	}
+	return func(req *http.Request) string {
+		direct, _, err := net.SplitHostPort(req.RemoteAddr)
+		if err != nil {
+			direct = req.RemoteAddr
+		}
+		if !containsIP(nets, net.ParseIP(direct)) {
+			return direct
+		}
+		chain := forwardedFor(req.Header, header)
+		for i := len(chain) - 1; i >= 0; i-- {
+			ip := net.ParseIP(chain[i])
+			if ip == nil {
+				// 混淆标识或unknown,无法继续向前追溯
+				return direct
+			}
+			if !containsIP(nets, ip) || i == 0 {
+				return ip.String()
+			}
+		}
+		return direct
+	}
+}
+
+// 按从客户端到最近代理的顺序返回header中的转发链地址
+func forwardedFor(h http.Header, header string) []string {
+	var chain []string
+	switch header {
+	case HeaderForwarded:
+		for _, v := range h.Values(HeaderForwarded) {
+			for _, elem := range strings.Split(v, ",") {
+				for _, pair := range strings.Split(elem, ";") {
+					pair = strings.TrimSpace(pair)
+					if len(pair) > 4 && strings.EqualFold(pair[:4], "for=") {
+						chain = append(chain, forwardedNode(pair[4:]))
+					}
+				}
+			}
+		}
+	case echo.HeaderXForwardedFor:
+		for _, v := range h.Values(echo.HeaderXForwardedFor) {
+			for _, ip := range strings.Split(v, ",") {
+				chain = append(chain, strings.TrimSpace(ip))
+			}
+		}
+	case echo.HeaderXRealIP:
+		if ip := h.Get(echo.HeaderXRealIP); len(ip) > 0 {
+			chain = append(chain, strings.TrimSpace(ip))
+		}
+	}
+	return chain
+}
+
+// 解析Forwarded中的节点,例如 192.0.2.60, "192.0.2.60:8080", "[2001:db8::1]:4711"
+func forwardedNode(node string) string {
+	node = strings.Trim(node, `"`)
+	if strings.HasPrefix(node, "[") {
+		if i := strings.Index(node, "]"); i > 0 {
+			return node[1:i]
+		}
+		return node
+	}
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		return host
+	}
+	return node
+}
+
+// ProxyProtocolListener 包装监听器以支持PROXY protocol v1/v2,只有来自受信任代理的连接才使用其中的客户端地址,
+// 其余连接发送PROXY头时拒绝.
+func ProxyProtocolListener(l net.Listener, trusted []string) net.Listener {
+	nets := parseCIDRs(trusted)
+	return &proxyproto.Listener{
+		Listener: l,
+		Policy: func(upstream net.Addr) (proxyproto.Policy, error) {
+			if addr, ok := upstream.(*net.TCPAddr); ok && containsIP(nets, addr.IP) {
+				return proxyproto.USE, nil
+			}
+			return proxyproto.REJECT, nil
+		},
+	}
+}
+
+// 解析IP或CIDR列表,单个IP视为/32(IPv6为/128),出错时panic,用于启动时的配置
+func parseCIDRs(list []string) []*net.IPNet {
+	nets, err := parseCIDRList(list)
+	if err != nil {
+		panic(err.Error())
+	}
+	return nets
+}
+
+func parseCIDRList(list []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(list))
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			if ip := net.ParseIP(s); ip != nil && ip.To4() != nil {
+				s += "/32"
+			} else {
+				s += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, errors.New("解析IP地址[" + s + "]出错:" + err.Error())
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
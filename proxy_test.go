@@ -0,0 +1,92 @@
+package web_test
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aluka-7/web"
+	"github.com/pires/go-proxyproto"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTrustedProxyIPExtractor(t *testing.T) {
+	Convey("test TrustedProxyIPExtractor\n", t, func() {
+		trusted := []string{"10.0.0.0/8", "2001:db8::1"}
+		extract := web.TrustedProxyIPExtractor(trusted, "")
+		req := func(remote string, header ...string) *http.Request {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = remote
+			for i := 0; i < len(header); i += 2 {
+				r.Header.Add(header[i], header[i+1])
+			}
+			return r
+		}
+
+		// 不受信任的直连地址不采信转发头
+		So(extract(req("203.0.113.1:1234", "X-Forwarded-For", "1.1.1.1")), ShouldEqual, "203.0.113.1")
+		So(extract(req("10.0.0.2:1234")), ShouldEqual, "10.0.0.2")
+		So(extract(req("10.0.0.2:1234", "X-Forwarded-For", "1.1.1.1, 198.51.100.7, 10.0.0.3")), ShouldEqual, "198.51.100.7")
+		So(extract(req("10.0.0.2:1234", "X-Forwarded-For", "10.0.0.9")), ShouldEqual, "10.0.0.9")
+
+		// 只读取代理设置的转发头,客户端伪造的其他转发头被忽略
+		So(extract(req("10.0.0.2:1234", "Forwarded", "for=1.2.3.4", "X-Forwarded-For", "198.51.100.7")), ShouldEqual, "198.51.100.7")
+		So(extract(req("10.0.0.2:1234", "Forwarded", "for=1.2.3.4")), ShouldEqual, "10.0.0.2")
+		So(extract(req("10.0.0.2:1234", "X-Real-IP", "1.2.3.4")), ShouldEqual, "10.0.0.2")
+		So(web.TrustedProxyIPExtractor(trusted, "x-real-ip")(req("10.0.0.2:1234", "X-Real-IP", "198.51.100.7")), ShouldEqual, "198.51.100.7")
+
+		forwarded := web.TrustedProxyIPExtractor(trusted, web.HeaderForwarded)
+		So(forwarded(req("10.0.0.2:1234",
+			"Forwarded", `for=192.0.2.43, for="[2001:db8:cafe::17]:4711";proto=https`,
+			"X-Forwarded-For", "1.1.1.1")), ShouldEqual, "2001:db8:cafe::17")
+		So(forwarded(req("[2001:db8::1]:443", "Forwarded", `for="192.0.2.60:8080";by=10.0.0.1`)), ShouldEqual, "192.0.2.60")
+		So(forwarded(req("10.0.0.2:1234", "Forwarded", "for=_hidden")), ShouldEqual, "10.0.0.2")
+		So(forwarded(req("10.0.0.2:1234", "X-Forwarded-For", "1.1.1.1")), ShouldEqual, "10.0.0.2")
+
+		So(func() { web.TrustedProxyIPExtractor(trusted, "X-Client-IP") }, ShouldPanic)
+	})
+}
+
+func TestProxyProtocolListener(t *testing.T) {
+	Convey("test ProxyProtocolListener\n", t, func() {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(r.RemoteAddr))
+		})}
+		go func() { _ = srv.Serve(web.ProxyProtocolListener(l, []string{"127.0.0.1"})) }()
+		defer srv.Close()
+
+		get := func(header *proxyproto.Header) string {
+			conn, err := net.Dial("tcp", l.Addr().String())
+			So(err, ShouldBeNil)
+			defer conn.Close()
+			if header != nil {
+				_, err = header.WriteTo(conn)
+				So(err, ShouldBeNil)
+			}
+			_, err = conn.Write([]byte("GET / HTTP/1.0\r\nHost: test\r\n\r\n"))
+			So(err, ShouldBeNil)
+			resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+			So(err, ShouldBeNil)
+			body, _ := ioutil.ReadAll(resp.Body)
+			return string(body)
+		}
+		header := func(version byte) *proxyproto.Header {
+			return &proxyproto.Header{
+				Version:           version,
+				Command:           proxyproto.PROXY,
+				TransportProtocol: proxyproto.TCPv4,
+				SourceAddr:        &net.TCPAddr{IP: net.ParseIP("203.0.113.9"), Port: 5555},
+				DestinationAddr:   &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 80},
+			}
+		}
+
+		So(get(header(1)), ShouldEqual, "203.0.113.9:5555")
+		So(get(header(2)), ShouldEqual, "203.0.113.9:5555")
+		So(get(nil), ShouldStartWith, "127.0.0.1:")
+	})
+}
@@ -0,0 +1,99 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+
+	"github.com/aluka-7/metric"
+	"github.com/aluka-7/trace"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/labstack/gommon/log"
+)
+
+var _metricServerPanics = metric.NewCounterVec(&metric.CounterVecOpts{
+	Namespace: serverNamespace,
+	Subsystem: "requests",
+	Name:      "panic_total",
+	Help:      "http server requests panic count.",
+	Labels:    []string{"path", "method"},
+})
+
+// RecoverConfig panic恢复中间件配置
+type RecoverConfig struct {
+	// Skipper defines a function to skip middleware.
+	Skipper middleware.Skipper
+
+	// StackSize 记录的堆栈大小,默认4KB
+	StackSize int
+
+	// DisableStackAll 只记录当前goroutine的堆栈
+	DisableStackAll bool
+}
+
+// 处理器panic后返回的错误,不是metacode错误码,按服务器错误(-500)响应,不会将panic内容返回给客户端
+type panicError struct {
+	value interface{}
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.value)
+}
+
+// RecoverWithConfig panic恢复中间件,记录堆栈,将链路标记为错误,输出包含请求id的结构化日志并计数,
+// 之后返回错误由HTTPErrorHandler统一响应.需注册在Trace及LoggerWithConfig之后,panic才会体现在链路及访问日志中;
+// Trace及LoggerWithConfig自身的panic不在其范围内,需在最外层另外注册middleware.Recover兜底.
+func RecoverWithConfig(config RecoverConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	if config.StackSize == 0 {
+		config.StackSize = 4 << 10
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) (err error) {
+			if config.Skipper(c) {
+				return next(c)
+			}
+			defer func() {
+				r := recover()
+				if r == nil {
+					return
+				}
+				// 由net/http处理,用于中止响应
+				if r == http.ErrAbortHandler {
+					panic(r)
+				}
+				stack := make([]byte, config.StackSize)
+				stack = stack[:runtime.Stack(stack, !config.DisableStackAll)]
+				pe := &panicError{value: r}
+				req := c.Request()
+				_metricServerPanics.Inc(c.Path(), req.Method)
+				if t, ok := trace.FromContext(req.Context()); ok {
+					t.SetTag(trace.Bool(trace.TagError, true), trace.String("panic", fmt.Sprint(r)))
+					t.SetLog(trace.Log(trace.LogEvent, "panic"), trace.Log(trace.LogMessage, pe.Error()), trace.Log(trace.LogStack, string(stack)))
+				}
+				c.Logger().Errorj(log.JSON{
+					"id":     requestID(c),
+					"method": req.Method,
+					"uri":    req.RequestURI,
+					"route":  c.Path(),
+					"panic":  fmt.Sprint(r),
+					"stack":  string(stack),
+				})
+				err = pe
+			}()
+			return next(c)
+		}
+	}
+}
+
+// 请求id,优先使用请求头中的X-Request-Id
+func requestID(c echo.Context) string {
+	id := c.Request().Header.Get(echo.HeaderXRequestID)
+	if id == "" {
+		id = c.Response().Header().Get(echo.HeaderXRequestID)
+	}
+	return id
+}
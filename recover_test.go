@@ -0,0 +1,51 @@
+package web_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aluka-7/web"
+	"github.com/labstack/echo/v4"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRecover(t *testing.T) {
+	Convey("test Recover middleware\n", t, func() {
+		var logs, access bytes.Buffer
+		e := echo.New()
+		e.HTTPErrorHandler = web.HTTPErrorHandler
+		e.Logger.SetOutput(&logs)
+		e.Use(web.Trace(), web.LoggerWithConfig("1000", true, web.LoggerConfig{Output: &access}), web.RecoverWithConfig(web.RecoverConfig{}))
+		e.GET("/panic/:id", func(c echo.Context) error {
+			panic("boom")
+		})
+		e.GET("/abort", func(c echo.Context) error {
+			panic(http.ErrAbortHandler)
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/panic/1", nil)
+		req.Header.Set(echo.HeaderXRequestID, "req-1")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		// 统一的错误响应,不包含panic内容
+		So(rec.Code, ShouldEqual, http.StatusInternalServerError)
+		var body web.ErrorResponse
+		So(json.Unmarshal(rec.Body.Bytes(), &body), ShouldBeNil)
+		So(body.Code, ShouldEqual, -500)
+		So(rec.Body.String(), ShouldNotContainSubstring, "boom")
+
+		// 结构化日志包含请求id及堆栈,访问日志记录错误
+		So(logs.String(), ShouldContainSubstring, `"id":"req-1"`)
+		So(logs.String(), ShouldContainSubstring, `"route":"/panic/:id"`)
+		So(logs.String(), ShouldContainSubstring, `"panic":"boom"`)
+		So(logs.String(), ShouldContainSubstring, "recover_test.go")
+		So(access.String(), ShouldContainSubstring, `"status":500`)
+		So(access.String(), ShouldContainSubstring, `"error":"panic: boom"`)
+
+		So(func() { e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/abort", nil)) }, ShouldPanicWith, http.ErrAbortHandler)
+	})
+}
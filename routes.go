@@ -0,0 +1,239 @@
+package web
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RoutesConfig 路由表相关配置
+type RoutesConfig struct {
+	Path string `json:"path"` // 路由表查询地址,为空时不开启,例如"/admin/routes"
+	Dump bool   `json:"dump"` // 启动时是否打印路由表
+}
+
+// RouteSpec 路由的补充说明信息,echo本身不会记录路由级中间件以及业务元数据,需要通过Describe声明.
+type RouteSpec struct {
+	Method     string                 `json:"method"`
+	Path       string                 `json:"path"`
+	Handler    string                 `json:"handler"`
+	Middleware []string               `json:"middleware,omitempty"`
+	Metadata   map[string]interface{} `json:"metadata,omitempty"`
+
+	// 接口文档信息,见Doc,Request,Response
+	summary   string
+	tags      []string
+	request   interface{}
+	responses map[int]interface{}
+
+	// 访问所需权限,见Require
+	permissions []string
+	// 请求体大小限制,见BodyLimit
+	bodyLimit int64
+}
+
+// 按echo实例分别记录,同一进程中的多个实例可以注册相同的路由
+var routeSpecs = struct {
+	sync.RWMutex
+	m map[*echo.Echo]map[string]*RouteSpec
+}{m: make(map[*echo.Echo]map[string]*RouteSpec)}
+
+// Describe 为eng中已注册的路由声明补充信息,同一路由多次调用返回同一个RouteSpec.
+//
+//	route := eng.GET("/users/:id", getUser, auth)
+//	web.Describe(eng, route).Use("auth").Meta("owner", "account")
+func Describe(eng *echo.Echo, r *echo.Route) *RouteSpec {
+	key := r.Method + r.Path
+	routeSpecs.Lock()
+	defer routeSpecs.Unlock()
+	specs, ok := routeSpecs.m[eng]
+	if !ok {
+		specs = make(map[string]*RouteSpec)
+		routeSpecs.m[eng] = specs
+	}
+	if s, ok := specs[key]; ok {
+		return s
+	}
+	s := &RouteSpec{Method: r.Method, Path: r.Path, Handler: r.Name}
+	specs[key] = s
+	return s
+}
+
+func lookupRouteSpec(eng *echo.Echo, method, path string) *RouteSpec {
+	routeSpecs.RLock()
+	defer routeSpecs.RUnlock()
+	return routeSpecs.m[eng][method+path]
+}
+
+// Use 声明路由级中间件名称(按执行顺序).
+func (s *RouteSpec) Use(names ...string) *RouteSpec {
+	s.Middleware = append(s.Middleware, names...)
+	return s
+}
+
+// Meta 设置路由元数据.
+func (s *RouteSpec) Meta(key string, value interface{}) *RouteSpec {
+	if s.Metadata == nil {
+		s.Metadata = make(map[string]interface{})
+	}
+	s.Metadata[key] = value
+	return s
+}
+
+// RouteInfo 路由表中的一条路由
+type RouteInfo struct {
+	Method     string                 `json:"method"`
+	Path       string                 `json:"path"`
+	Name       string                 `json:"name"`
+	Handler    string                 `json:"handler"`
+	Middleware []string               `json:"middleware"`
+	Metadata   map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// RouteIssue 路由冲突或被遮蔽的说明
+type RouteIssue struct {
+	Kind    string   `json:"kind"` // conflict或shadowed
+	Message string   `json:"message"`
+	Routes  []string `json:"routes"`
+}
+
+// RouteTable 路由表
+type RouteTable struct {
+	Routes []RouteInfo  `json:"routes"`
+	Issues []RouteIssue `json:"issues,omitempty"`
+}
+
+// InspectRoutes 汇总echo中已注册的路由,global为全局中间件名称.
+func InspectRoutes(eng *echo.Echo, global []string) RouteTable {
+	routes := eng.Routes()
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path == routes[j].Path {
+			return routes[i].Method < routes[j].Method
+		}
+		return routes[i].Path < routes[j].Path
+	})
+	table := RouteTable{Routes: make([]RouteInfo, 0, len(routes))}
+	for _, r := range routes {
+		info := RouteInfo{Method: r.Method, Path: r.Path, Name: r.Name, Handler: r.Name}
+		info.Middleware = append(info.Middleware, global...)
+		if s := lookupRouteSpec(eng, r.Method, r.Path); s != nil {
+			info.Handler = s.Handler
+			info.Middleware = append(info.Middleware, s.Middleware...)
+			info.Metadata = s.Metadata
+		}
+		table.Routes = append(table.Routes, info)
+	}
+	table.Issues = detectRouteIssues(eng, table.Routes)
+	return table
+}
+
+// 检测路由冲突和遮蔽:
+// 1.同一方法下参数名不同但结构相同的路由在echo中会共用一个节点,后注册的参数名会覆盖先注册的;
+// 2.通配符"*"会吞掉后续所有路径,其后的路径段永远无法匹配;
+// 3.分组调用Use时会为"prefix/*"注册占位路由,会覆盖之前注册在同一路径的业务路由.
+func detectRouteIssues(eng *echo.Echo, routes []RouteInfo) []RouteIssue {
+	var issues []RouteIssue
+	shapes := make(map[string][]RouteInfo)
+	var keys []string
+	placeholder := funcName(echo.NotFoundHandler)
+	for _, r := range routes {
+		key := r.Method + " " + routeShape(r.Path)
+		if _, ok := shapes[key]; !ok {
+			keys = append(keys, key)
+		}
+		shapes[key] = append(shapes[key], r)
+		if i := strings.Index(r.Path, "*"); i >= 0 && i < len(r.Path)-1 {
+			issues = append(issues, RouteIssue{
+				Kind:    "shadowed",
+				Message: fmt.Sprintf("通配符之后的路径[%s]永远不会被匹配", r.Path[i+1:]),
+				Routes:  []string{r.Method + " " + r.Path},
+			})
+		}
+		// Handler已被替换为Describe记录的处理器,实际注册的处理器需从Name判断
+		if r.Name == placeholder && strings.HasSuffix(r.Path, "/*") {
+			if s := lookupRouteSpec(eng, r.Method, r.Path); s != nil && s.Handler != placeholder {
+				issues = append(issues, RouteIssue{
+					Kind:    "shadowed",
+					Message: fmt.Sprintf("路由处理器[%s]被分组中间件注册的占位路由覆盖", s.Handler),
+					Routes:  []string{r.Method + " " + r.Path},
+				})
+			}
+		}
+	}
+	for _, key := range keys {
+		group := shapes[key]
+		if len(group) < 2 {
+			continue
+		}
+		conflict := RouteIssue{Kind: "conflict", Message: "路由结构相同但参数名不同,参数名将以最后注册的为准"}
+		for _, r := range group {
+			conflict.Routes = append(conflict.Routes, r.Method+" "+r.Path)
+		}
+		issues = append(issues, conflict)
+	}
+	return issues
+}
+
+// 将路径中的参数名抹去,得到路由在路由树中的结构
+func routeShape(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if strings.HasPrefix(s, ":") {
+			segments[i] = ":"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// WriteTable 以表格形式输出路由表
+func (t RouteTable) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "METHOD\tPATH\tNAME\tHANDLER\tMIDDLEWARE\tMETADATA")
+	for _, r := range t.Routes {
+		var meta []string
+		for k, v := range r.Metadata {
+			meta = append(meta, fmt.Sprintf("%s=%v", k, v))
+		}
+		sort.Strings(meta)
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Method, r.Path, r.Name, r.Handler,
+			strings.Join(r.Middleware, ","), strings.Join(meta, ","))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, i := range t.Issues {
+		if _, err := fmt.Fprintf(w, "[%s] %s: %s\n", i.Kind, strings.Join(i.Routes, " | "), i.Message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RoutesHandler 路由表查询接口,默认返回JSON,format=table时返回文本表格.
+func RoutesHandler(global func() []string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		table := InspectRoutes(c.Echo(), global())
+		if c.QueryParam("format") == "table" {
+			c.Response().Header().Set(echo.HeaderContentType, echo.MIMETextPlainCharsetUTF8)
+			c.Response().WriteHeader(http.StatusOK)
+			return table.WriteTable(c.Response())
+		}
+		return c.JSON(http.StatusOK, table)
+	}
+}
+
+func funcName(i interface{}) string {
+	v := reflect.ValueOf(i)
+	if v.Kind() == reflect.Func {
+		return runtime.FuncForPC(v.Pointer()).Name()
+	}
+	return v.Type().String()
+}
@@ -0,0 +1,58 @@
+package web_test
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/aluka-7/web"
+	"github.com/labstack/echo/v4"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestInspectRoutes(t *testing.T) {
+	Convey("test InspectRoutes\n", t, func() {
+		e := echo.New()
+		h := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+		web.Describe(e, e.GET("/users/:id", h)).Use("auth").Meta("owner", "account")
+		e.GET("/users/:name", h)
+		e.GET("/files/*/raw", h)
+		e.POST("/users", h)
+
+		table := web.InspectRoutes(e, []string{"trace"})
+		So(len(table.Routes), ShouldEqual, 4)
+		var kinds []string
+		for _, i := range table.Issues {
+			kinds = append(kinds, i.Kind)
+		}
+		So(kinds, ShouldContain, "conflict")
+		So(kinds, ShouldContain, "shadowed")
+		for _, r := range table.Routes {
+			if r.Path == "/users/:id" {
+				So(r.Middleware, ShouldResemble, []string{"trace", "auth"})
+				So(r.Metadata["owner"], ShouldEqual, "account")
+			}
+		}
+
+		buf := new(bytes.Buffer)
+		So(table.WriteTable(buf), ShouldBeNil)
+		So(buf.String(), ShouldContainSubstring, "/users/:id")
+
+		// 分组中间件注册的占位路由覆盖之前的业务路由
+		e = echo.New()
+		web.Describe(e, e.GET("/legacy/*", h))
+		e.Group("/legacy").Use(func(next echo.HandlerFunc) echo.HandlerFunc { return next })
+		table = web.InspectRoutes(e, nil)
+		So(len(table.Issues), ShouldEqual, 1)
+		So(table.Issues[0].Kind, ShouldEqual, "shadowed")
+		So(table.Issues[0].Routes, ShouldResemble, []string{"GET /legacy/*"})
+
+		// 不同实例中的相同路由互不影响
+		admin, public := echo.New(), echo.New()
+		web.Describe(admin, admin.GET("/orders", h)).Use("auth").Meta("owner", "order")
+		public.GET("/orders", h)
+		So(web.InspectRoutes(admin, nil).Routes[0].Metadata["owner"], ShouldEqual, "order")
+		So(web.InspectRoutes(public, nil).Routes[0].Middleware, ShouldBeEmpty)
+		So(web.InspectRoutes(public, nil).Routes[0].Metadata, ShouldBeNil)
+	})
+}
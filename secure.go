@@ -0,0 +1,221 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/aluka-7/metric"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const (
+	cspNonceKey = "web.csp.nonce"
+	// CSPNoncePlaceholder ContentSecurityPolicy中的该占位符会被替换为'nonce-<随机值>'
+	CSPNoncePlaceholder = "{nonce}"
+)
+
+var _metricCSPReports = metric.NewCounterVec(&metric.CounterVecOpts{
+	Namespace: serverNamespace,
+	Subsystem: "csp",
+	Name:      "reports_total",
+	Help:      "http server csp violation reports count.",
+	Labels:    []string{"directive"},
+})
+
+// 已知的CSP指令,报告中的指令来自未经认证的请求体,其余值计为other,避免指标的标签无限增长
+var cspDirectives = map[string]bool{
+	"default-src": true, "script-src": true, "script-src-elem": true, "script-src-attr": true,
+	"style-src": true, "style-src-elem": true, "style-src-attr": true, "img-src": true,
+	"font-src": true, "connect-src": true, "media-src": true, "object-src": true,
+	"frame-src": true, "child-src": true, "worker-src": true, "manifest-src": true,
+	"prefetch-src": true, "base-uri": true, "form-action": true, "frame-ancestors": true,
+	"navigate-to": true, "sandbox": true, "plugin-types": true, "require-trusted-types-for": true,
+	"trusted-types": true, "upgrade-insecure-requests": true, "block-all-mixed-content": true,
+}
+
+// SecureConfig 安全响应头配置,字段为空时不输出对应的响应头
+type SecureConfig struct {
+	// Skipper defines a function to skip middleware.
+	Skipper middleware.Skipper
+
+	// HSTSMaxAge Strict-Transport-Security的max-age(秒),只在HTTPS请求中输出
+	HSTSMaxAge            int
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+
+	// ContentTypeNosniff X-Content-Type-Options,通常为"nosniff"
+	ContentTypeNosniff string
+
+	// FrameOptions X-Frame-Options,DENY或SAMEORIGIN
+	FrameOptions string
+
+	// ReferrerPolicy Referrer-Policy
+	ReferrerPolicy string
+
+	// ContentSecurityPolicy 可包含CSPNoncePlaceholder,例如"script-src 'self' {nonce}"
+	ContentSecurityPolicy string
+
+	// CSPReportOnly 使用Content-Security-Policy-Report-Only,只上报不拦截
+	CSPReportOnly bool
+
+	// CSPReportURI 违规上报地址,通常为CSPReportHandler注册的地址
+	CSPReportURI string
+}
+
+// DefaultSecureConfig is the default Secure middleware config.
+var DefaultSecureConfig = SecureConfig{
+	HSTSMaxAge:            31536000,
+	ContentTypeNosniff:    "nosniff",
+	FrameOptions:          "SAMEORIGIN",
+	ReferrerPolicy:        "strict-origin-when-cross-origin",
+	ContentSecurityPolicy: "default-src 'self'; script-src 'self' " + CSPNoncePlaceholder + "; object-src 'none'; base-uri 'self'",
+}
+
+// SecureWithConfig 输出安全响应头,CSP包含nonce占位符时为每个请求生成nonce,
+// 可通过CSPNonce获取,webAppTemplate.Render会以.CSPNonce注入视图,例如:
+//
+//	<script nonce="{{.CSPNonce}}">...</script>
+func SecureWithConfig(config SecureConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	hsts := ""
+	if config.HSTSMaxAge > 0 {
+		hsts = fmt.Sprintf("max-age=%d", config.HSTSMaxAge)
+		if config.HSTSIncludeSubdomains {
+			hsts += "; includeSubdomains"
+		}
+		if config.HSTSPreload {
+			hsts += "; preload"
+		}
+	}
+	csp := config.ContentSecurityPolicy
+	if len(csp) > 0 && len(config.CSPReportURI) > 0 {
+		csp += "; report-uri " + config.CSPReportURI
+	}
+	cspHeader := echo.HeaderContentSecurityPolicy
+	if config.CSPReportOnly {
+		cspHeader = echo.HeaderContentSecurityPolicyReportOnly
+	}
+	withNonce := strings.Contains(csp, CSPNoncePlaceholder)
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+			h := c.Response().Header()
+			if len(hsts) > 0 && (c.IsTLS() || c.Scheme() == "https") {
+				h.Set(echo.HeaderStrictTransportSecurity, hsts)
+			}
+			if len(config.ContentTypeNosniff) > 0 {
+				h.Set(echo.HeaderXContentTypeOptions, config.ContentTypeNosniff)
+			}
+			if len(config.FrameOptions) > 0 {
+				h.Set(echo.HeaderXFrameOptions, config.FrameOptions)
+			}
+			if len(config.ReferrerPolicy) > 0 {
+				h.Set(echo.HeaderReferrerPolicy, config.ReferrerPolicy)
+			}
+			if len(csp) > 0 {
+				policy := csp
+				if withNonce {
+					nonce := randomToken()
+					c.Set(cspNonceKey, nonce)
+					policy = strings.Replace(policy, CSPNoncePlaceholder, "'nonce-"+nonce+"'", -1)
+				}
+				h.Set(cspHeader, policy)
+			}
+			return next(c)
+		}
+	}
+}
+
+// CSPNonce 返回当前请求的CSP nonce,未生成时返回空串
+func CSPNonce(c echo.Context) string {
+	n, _ := c.Get(cspNonceKey).(string)
+	return n
+}
+
+// CSPReport 一条CSP违规报告
+type CSPReport struct {
+	DocumentURI        string `json:"document-uri"`
+	Referrer           string `json:"referrer"`
+	ViolatedDirective  string `json:"violated-directive"`
+	EffectiveDirective string `json:"effective-directive"`
+	OriginalPolicy     string `json:"original-policy"`
+	BlockedURI         string `json:"blocked-uri"`
+	SourceFile         string `json:"source-file"`
+	LineNumber         int    `json:"line-number"`
+}
+
+// CSPReportHandler 接收浏览器的CSP违规报告,支持report-uri(application/csp-report)和Reporting API(application/reports+json)格式,
+// 报告按指令计数并记录日志,handler不为nil时再交给handler处理.
+func CSPReportHandler(handler func(c echo.Context, r CSPReport)) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		body, err := ioutil.ReadAll(io.LimitReader(c.Request().Body, 64<<10))
+		if err != nil {
+			return err
+		}
+		for _, r := range parseCSPReports(body) {
+			directive := r.EffectiveDirective
+			if len(directive) == 0 {
+				directive = strings.SplitN(r.ViolatedDirective, " ", 2)[0]
+			}
+			if !cspDirectives[directive] {
+				directive = "other"
+			}
+			_metricCSPReports.Inc(directive)
+			c.Logger().Warnf("CSP违规:document=%s directive=%s blocked=%s source=%s:%d",
+				r.DocumentURI, directive, r.BlockedURI, r.SourceFile, r.LineNumber)
+			if handler != nil {
+				handler(c, r)
+			}
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+func parseCSPReports(body []byte) []CSPReport {
+	var legacy struct {
+		Report *CSPReport `json:"csp-report"`
+	}
+	if err := json.Unmarshal(body, &legacy); err == nil && legacy.Report != nil {
+		return []CSPReport{*legacy.Report}
+	}
+	var reports []struct {
+		Type string `json:"type"`
+		Body struct {
+			DocumentURL        string `json:"documentURL"`
+			Referrer           string `json:"referrer"`
+			EffectiveDirective string `json:"effectiveDirective"`
+			OriginalPolicy     string `json:"originalPolicy"`
+			BlockedURL         string `json:"blockedURL"`
+			SourceFile         string `json:"sourceFile"`
+			LineNumber         int    `json:"lineNumber"`
+		} `json:"body"`
+	}
+	if err := json.Unmarshal(body, &reports); err != nil {
+		return nil
+	}
+	var list []CSPReport
+	for _, r := range reports {
+		if r.Type != "csp-violation" {
+			continue
+		}
+		list = append(list, CSPReport{
+			DocumentURI:        r.Body.DocumentURL,
+			Referrer:           r.Body.Referrer,
+			EffectiveDirective: r.Body.EffectiveDirective,
+			OriginalPolicy:     r.Body.OriginalPolicy,
+			BlockedURI:         r.Body.BlockedURL,
+			SourceFile:         r.Body.SourceFile,
+			LineNumber:         r.Body.LineNumber,
+		})
+	}
+	return list
+}
@@ -0,0 +1,100 @@
+package web_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aluka-7/web"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSecure(t *testing.T) {
+	Convey("test Secure middleware\n", t, func() {
+		dir, err := ioutil.TempDir("", "views")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		So(os.MkdirAll(filepath.Join(dir, "common"), 0755), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(dir, "common", "layout.html"),
+			[]byte(`<html>{{yield}}<script nonce="{{.CSPNonce}}">init()</script></html>`), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte(`<h1>{{.name}}</h1>`), 0644), ShouldBeNil)
+
+		var reports []web.CSPReport
+		config := web.DefaultSecureConfig
+		config.CSPReportURI = "/csp-report"
+		e := echo.New()
+		e.Renderer = web.NewWebAppTemplate(web.RenderOptions{Directory: dir, Layout: "common/layout"})
+		e.Use(web.SecureWithConfig(config))
+		e.GET("/", func(c echo.Context) error {
+			return c.Render(http.StatusOK, "index", map[string]interface{}{"name": "tom"})
+		})
+		e.POST("/csp-report", web.CSPReportHandler(func(c echo.Context, r web.CSPReport) {
+			reports = append(reports, r)
+		}))
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		So(rec.Code, ShouldEqual, http.StatusOK)
+		h := rec.Header()
+		So(h.Get(echo.HeaderXContentTypeOptions), ShouldEqual, "nosniff")
+		So(h.Get(echo.HeaderXFrameOptions), ShouldEqual, "SAMEORIGIN")
+		So(h.Get(echo.HeaderStrictTransportSecurity), ShouldEqual, "")
+		csp := h.Get(echo.HeaderContentSecurityPolicy)
+		So(csp, ShouldEndWith, "; report-uri /csp-report")
+		i := strings.Index(csp, "'nonce-")
+		So(i, ShouldBeGreaterThan, 0)
+		nonce := csp[i+7 : i+strings.Index(csp[i:], "';")]
+		So(rec.Body.String(), ShouldContainSubstring, `<h1>tom</h1><script nonce="`+nonce+`">`)
+
+		// 每个请求的nonce不同,HTTPS请求输出HSTS
+		req = httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(echo.HeaderXForwardedProto, "https")
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		So(rec.Header().Get(echo.HeaderContentSecurityPolicy), ShouldNotContainSubstring, nonce)
+		So(rec.Header().Get(echo.HeaderStrictTransportSecurity), ShouldEqual, "max-age=31536000")
+
+		for _, body := range []string{
+			`{"csp-report":{"document-uri":"https://a.com/","violated-directive":"script-src-elem","blocked-uri":"inline"}}`,
+			`[{"type":"csp-violation","body":{"documentURL":"https://a.com/","effectiveDirective":"img-src","blockedURL":"https://evil.com/x.png"}}]`,
+			`{"csp-report":{"violated-directive":"random-123 'self'"}}`,
+		} {
+			req = httptest.NewRequest(http.MethodPost, "/csp-report", strings.NewReader(body))
+			rec = httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			So(rec.Code, ShouldEqual, http.StatusNoContent)
+		}
+		So(len(reports), ShouldEqual, 3)
+
+		// 未知的指令计为other
+		families, err := prometheus.DefaultGatherer.Gather()
+		So(err, ShouldBeNil)
+		var directives []string
+		for _, f := range families {
+			if f.GetName() == "http_server_csp_reports_total" {
+				for _, m := range f.Metric {
+					directives = append(directives, m.Label[0].GetValue())
+				}
+			}
+		}
+		So(directives, ShouldContain, "img-src")
+		So(directives, ShouldContain, "other")
+		So(directives, ShouldNotContain, "random-123")
+		So(reports[0].ViolatedDirective, ShouldEqual, "script-src-elem")
+		So(reports[1].BlockedURI, ShouldEqual, "https://evil.com/x.png")
+
+		// 仅上报模式
+		config.CSPReportOnly = true
+		e.Use(web.SecureWithConfig(config))
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		So(rec.Header().Get(echo.HeaderContentSecurityPolicyReportOnly), ShouldNotBeEmpty)
+	})
+}
@@ -0,0 +1,351 @@
+package web
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const sessionContextKey = "web.session"
+
+// SessionRecord 会话数据,由SessionStore保存
+type SessionRecord struct {
+	ID       string                 `json:"id"`
+	Values   map[string]interface{} `json:"values"`
+	Created  time.Time              `json:"created"`  // 创建时间,用于绝对过期
+	Accessed time.Time              `json:"accessed"` // 最后访问时间,用于空闲过期
+}
+
+// SessionStore 会话存储接口
+type SessionStore interface {
+	// Load 根据cookie中的值加载会话,不存在时返回nil
+	Load(value string) (*SessionRecord, error)
+	// Save 保存会话,返回需要写入cookie的值
+	Save(r *SessionRecord) (string, error)
+	// Delete 删除会话
+	Delete(id string) error
+}
+
+// SessionConfig 会话中间件配置
+type SessionConfig struct {
+	// Skipper defines a function to skip middleware.
+	Skipper middleware.Skipper
+
+	// Store 会话存储,必填
+	Store SessionStore
+
+	// CookieName 默认为"SESSIONID"
+	CookieName string
+	Domain     string
+	Path       string // 默认为"/"
+	Secure     bool
+	SameSite   http.SameSite // 默认为Lax
+
+	// IdleTimeout 空闲过期时间,为0时不限制
+	IdleTimeout time.Duration
+
+	// AbsoluteTimeout 从创建开始的绝对过期时间,为0时不限制
+	AbsoluteTimeout time.Duration
+}
+
+// SessionData 当前请求的会话
+type SessionData struct {
+	record    *SessionRecord
+	inCookie  bool // 会话数据保存在cookie中,受cookie大小限制
+	oldID     string
+	dirty     bool
+	destroyed bool
+}
+
+// SessionWithConfig 会话中间件,会话在响应头写出前保存.
+func SessionWithConfig(config SessionConfig) echo.MiddlewareFunc {
+	if config.Store == nil {
+		panic("session store is required")
+	}
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	if len(config.CookieName) == 0 {
+		config.CookieName = "SESSIONID"
+	}
+	if len(config.Path) == 0 {
+		config.Path = "/"
+	}
+	if config.SameSite == 0 {
+		config.SameSite = http.SameSiteLaxMode
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+			now := time.Now()
+			var record *SessionRecord
+			if cookie, err := c.Cookie(config.CookieName); err == nil {
+				if record, err = config.Store.Load(cookie.Value); err != nil {
+					c.Logger().Warnf("加载会话出错:%+v", err)
+				}
+			}
+			if record != nil && config.expired(record, now) {
+				_ = config.Store.Delete(record.ID)
+				record = nil
+			}
+			// 已有会话需要刷新访问时间以延长空闲过期,新会话只有写入值后才保存
+			s := &SessionData{record: record, dirty: record != nil && config.IdleTimeout > 0}
+			_, s.inCookie = config.Store.(*cookieSessionStore)
+			if record == nil {
+				s.record = &SessionRecord{ID: newSessionID(), Values: make(map[string]interface{}), Created: now}
+			}
+			s.record.Accessed = now
+			c.Set(sessionContextKey, s)
+			c.Response().Before(func() {
+				if err := config.save(c, s); err != nil {
+					c.Logger().Errorf("保存会话出错:%+v", err)
+				}
+			})
+			return next(c)
+		}
+	}
+}
+
+func (config SessionConfig) expired(r *SessionRecord, now time.Time) bool {
+	return (config.IdleTimeout > 0 && now.Sub(r.Accessed) > config.IdleTimeout) ||
+		(config.AbsoluteTimeout > 0 && now.Sub(r.Created) > config.AbsoluteTimeout)
+}
+
+func (config SessionConfig) save(c echo.Context, s *SessionData) error {
+	cookie := &http.Cookie{
+		Name:     config.CookieName,
+		Domain:   config.Domain,
+		Path:     config.Path,
+		Secure:   config.Secure,
+		HttpOnly: true,
+		SameSite: config.SameSite,
+	}
+	if len(s.oldID) > 0 {
+		if err := config.Store.Delete(s.oldID); err != nil {
+			return err
+		}
+	}
+	if s.destroyed {
+		cookie.MaxAge = -1
+		c.SetCookie(cookie)
+		return config.Store.Delete(s.record.ID)
+	}
+	if !s.dirty {
+		return nil
+	}
+	value, err := config.Store.Save(s.record)
+	if err != nil {
+		return err
+	}
+	cookie.Value = value
+	if config.AbsoluteTimeout > 0 {
+		cookie.Expires = s.record.Created.Add(config.AbsoluteTimeout)
+	}
+	c.SetCookie(cookie)
+	return nil
+}
+
+// Session 返回当前请求的会话,未使用会话中间件时返回nil.
+func Session(c echo.Context) *SessionData {
+	s, _ := c.Get(sessionContextKey).(*SessionData)
+	return s
+}
+
+// ID 返回会话ID
+func (s *SessionData) ID() string {
+	return s.record.ID
+}
+
+func (s *SessionData) Get(key string) interface{} {
+	return s.record.Values[key]
+}
+
+func (s *SessionData) Set(key string, value interface{}) {
+	s.record.Values[key] = value
+	s.dirty = true
+}
+
+func (s *SessionData) Delete(key string) {
+	delete(s.record.Values, key)
+	s.dirty = true
+}
+
+// Values 返回全部会话值,模板中可通过.Session访问
+func (s *SessionData) Values() map[string]interface{} {
+	return s.record.Values
+}
+
+// RotateID 更换会话ID并保留数据,登录等权限变化时调用以防止会话固定攻击.
+func (s *SessionData) RotateID() {
+	if len(s.oldID) == 0 {
+		s.oldID = s.record.ID
+	}
+	s.record.ID = newSessionID()
+	s.dirty = true
+}
+
+// Destroy 销毁会话并删除cookie
+func (s *SessionData) Destroy() {
+	s.record.Values = make(map[string]interface{})
+	s.destroyed = true
+}
+
+func newSessionID() string {
+	return randomToken()
+}
+
+// 生成256位随机串
+func randomToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// NewMemorySessionStore 创建进程内会话存储,过期时间与中间件的空闲及绝对过期时间一致时可及时清理内存.
+func NewMemorySessionStore(idle, absolute time.Duration) SessionStore {
+	return &memorySessionStore{records: make(map[string]*SessionRecord), idle: idle, absolute: absolute}
+}
+
+type memorySessionStore struct {
+	lock     sync.Mutex
+	records  map[string]*SessionRecord
+	idle     time.Duration
+	absolute time.Duration
+	lastGC   time.Time
+}
+
+func (m *memorySessionStore) Load(id string) (*SessionRecord, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	r, ok := m.records[id]
+	if !ok {
+		return nil, nil
+	}
+	// 返回副本,避免并发请求同时修改
+	cp := *r
+	cp.Values = make(map[string]interface{}, len(r.Values))
+	for k, v := range r.Values {
+		cp.Values[k] = v
+	}
+	return &cp, nil
+}
+
+func (m *memorySessionStore) Save(r *SessionRecord) (string, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.records[r.ID] = r
+	m.gc(time.Now())
+	return r.ID, nil
+}
+
+func (m *memorySessionStore) Delete(id string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.records, id)
+	return nil
+}
+
+// 每分钟最多清理一次过期会话
+func (m *memorySessionStore) gc(now time.Time) {
+	if (m.idle == 0 && m.absolute == 0) || now.Sub(m.lastGC) < time.Minute {
+		return
+	}
+	m.lastGC = now
+	for id, r := range m.records {
+		if (m.idle > 0 && now.Sub(r.Accessed) > m.idle) || (m.absolute > 0 && now.Sub(r.Created) > m.absolute) {
+			delete(m.records, id)
+		}
+	}
+}
+
+// NewCookieSessionStore 创建将会话保存在cookie中的存储,会话值以JSON编码.
+// hashKey用于HMAC-SHA256签名,长度至少为32字节;blockKey不为空时使用AES-GCM加密,长度必须为16,24或32字节.
+func NewCookieSessionStore(hashKey, blockKey []byte) SessionStore {
+	if len(hashKey) < 32 {
+		panic("会话签名密钥长度至少为32字节")
+	}
+	s := &cookieSessionStore{hashKey: hashKey}
+	if len(blockKey) > 0 {
+		block, err := aes.NewCipher(blockKey)
+		if err != nil {
+			panic("创建会话加密算法出错:" + err.Error())
+		}
+		if s.aead, err = cipher.NewGCM(block); err != nil {
+			panic("创建会话加密算法出错:" + err.Error())
+		}
+	}
+	return s
+}
+
+type cookieSessionStore struct {
+	hashKey []byte
+	aead    cipher.AEAD
+}
+
+var errInvalidSessionCookie = errors.New("session: invalid cookie")
+
+func (s *cookieSessionStore) Load(value string) (*SessionRecord, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(data) < sha256.Size {
+		return nil, errInvalidSessionCookie
+	}
+	payload, sum := data[:len(data)-sha256.Size], data[len(data)-sha256.Size:]
+	if !hmac.Equal(sum, s.sign(payload)) {
+		return nil, errInvalidSessionCookie
+	}
+	if s.aead != nil {
+		n := s.aead.NonceSize()
+		if len(payload) < n {
+			return nil, errInvalidSessionCookie
+		}
+		if payload, err = s.aead.Open(nil, payload[:n], payload[n:], nil); err != nil {
+			return nil, errInvalidSessionCookie
+		}
+	}
+	r := new(SessionRecord)
+	if err = json.Unmarshal(payload, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (s *cookieSessionStore) Save(r *SessionRecord) (string, error) {
+	payload, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	if s.aead != nil {
+		nonce := make([]byte, s.aead.NonceSize())
+		if _, err = rand.Read(nonce); err != nil {
+			return "", err
+		}
+		payload = s.aead.Seal(nonce, nonce, payload, nil)
+	}
+	return base64.RawURLEncoding.EncodeToString(append(payload, s.sign(payload)...)), nil
+}
+
+// 会话数据全部在cookie中,删除由中间件清除cookie完成
+func (s *cookieSessionStore) Delete(string) error {
+	return nil
+}
+
+func (s *cookieSessionStore) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, s.hashKey)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
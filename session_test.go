@@ -0,0 +1,71 @@
+package web_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aluka-7/web"
+	"github.com/labstack/echo/v4"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSession(t *testing.T) {
+	stores := map[string]web.SessionStore{
+		"memory": web.NewMemorySessionStore(time.Minute, time.Hour),
+		"cookie": web.NewCookieSessionStore([]byte("0123456789abcdef0123456789abcdef"), []byte("0123456789abcdef")),
+	}
+	for name, store := range stores {
+		Convey("test Session with "+name+" store\n", t, func() {
+			e := echo.New()
+			e.Use(web.SessionWithConfig(web.SessionConfig{Store: store, IdleTimeout: time.Minute, AbsoluteTimeout: time.Hour}))
+			e.POST("/login", func(c echo.Context) error {
+				s := web.Session(c)
+				s.RotateID()
+				s.Set("user", "tom")
+				return c.NoContent(http.StatusOK)
+			})
+			e.GET("/me", func(c echo.Context) error {
+				user, _ := web.Session(c).Get("user").(string)
+				return c.String(http.StatusOK, user)
+			})
+			e.POST("/logout", func(c echo.Context) error {
+				web.Session(c).Destroy()
+				return c.NoContent(http.StatusOK)
+			})
+			do := func(method, path string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(method, path, nil)
+				for _, c := range cookies {
+					req.AddCookie(c)
+				}
+				rec := httptest.NewRecorder()
+				e.ServeHTTP(rec, req)
+				return rec
+			}
+
+			rec := do(http.MethodGet, "/me", nil)
+			So(rec.Body.String(), ShouldEqual, "")
+			So(rec.Result().Cookies(), ShouldBeEmpty)
+
+			cookies := do(http.MethodPost, "/login", nil).Result().Cookies()
+			So(len(cookies), ShouldEqual, 1)
+			So(do(http.MethodGet, "/me", cookies).Body.String(), ShouldEqual, "tom")
+
+			tampered := *cookies[0]
+			first := "x"
+			if tampered.Value[0] == 'x' {
+				first = "y"
+			}
+			tampered.Value = first + tampered.Value[1:]
+			So(do(http.MethodGet, "/me", []*http.Cookie{&tampered}).Body.String(), ShouldEqual, "")
+
+			logout := do(http.MethodPost, "/logout", cookies).Result().Cookies()
+			So(logout[0].MaxAge, ShouldBeLessThan, 0)
+		})
+	}
+	Convey("test cookie store keys\n", t, func() {
+		So(func() { web.NewCookieSessionStore([]byte("hash-key"), nil) }, ShouldPanic)
+		So(func() { web.NewCookieSessionStore([]byte("0123456789abcdef0123456789abcdef"), []byte("short")) }, ShouldPanic)
+	})
+}
@@ -0,0 +1,282 @@
+package web
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aluka-7/configuration"
+	"github.com/aluka-7/metacode"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// 请求签名使用的请求头
+const (
+	HeaderAppKey    = "X-App-Key"
+	HeaderTimestamp = "X-Timestamp"
+	HeaderNonce     = "X-Nonce"
+	HeaderSignature = "X-Signature"
+)
+
+// NonceStore 保存已使用的nonce,用于防止请求重放
+type NonceStore interface {
+	// Use 标记nonce已使用并保留ttl时间,nonce已被使用过时返回false
+	Use(key string, ttl time.Duration) (bool, error)
+}
+
+// NewMemoryNonceStore 创建进程内的nonce存储,多实例部署时应当使用共享存储实现.
+func NewMemoryNonceStore() NonceStore {
+	return &memoryNonceStore{nonces: make(map[string]time.Time)}
+}
+
+type memoryNonceStore struct {
+	lock   sync.Mutex
+	nonces map[string]time.Time
+	lastGC time.Time
+}
+
+func (m *memoryNonceStore) Use(key string, ttl time.Duration) (bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	now := time.Now()
+	if now.Sub(m.lastGC) > time.Minute {
+		m.lastGC = now
+		for k, exp := range m.nonces {
+			if now.After(exp) {
+				delete(m.nonces, k)
+			}
+		}
+	}
+	if exp, ok := m.nonces[key]; ok && now.Before(exp) {
+		return false, nil
+	}
+	m.nonces[key] = now.Add(ttl)
+	return true, nil
+}
+
+// AppSecrets 按app-key保存的签名密钥,支持运行时更新.
+type AppSecrets struct {
+	lock    sync.RWMutex
+	secrets map[string]string
+}
+
+// NewAppSecrets 使用给定的app-key和密钥创建
+func NewAppSecrets(secrets map[string]string) *AppSecrets {
+	return &AppSecrets{secrets: secrets}
+}
+
+// NewAppSecretsFromConfig 从配置中心/system/base/signature/{systemId}加载密钥,配置为app-key到密钥的JSON对象,
+// 配置变化时自动更新.
+func NewAppSecretsFromConfig(conf configuration.Configuration, systemId string) *AppSecrets {
+	s := NewAppSecrets(nil)
+	conf.Get("base", "signature", "", []string{systemId}, s)
+	return s
+}
+
+// Changed 实现configuration.ChangedListener
+func (s *AppSecrets) Changed(data map[string]string) {
+	for path, v := range data {
+		secrets := make(map[string]string)
+		if err := json.Unmarshal([]byte(v), &secrets); err != nil {
+			fmt.Printf("更新签名密钥配置[%s]出错:%+v\n", path, err)
+			continue
+		}
+		s.lock.Lock()
+		s.secrets = secrets
+		s.lock.Unlock()
+	}
+}
+
+// Secret 返回app-key对应的密钥
+func (s *AppSecrets) Secret(appKey string) (string, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	secret, ok := s.secrets[appKey]
+	return secret, ok
+}
+
+// SignatureConfig 请求签名校验中间件配置
+type SignatureConfig struct {
+	// Skipper defines a function to skip middleware.
+	Skipper middleware.Skipper
+
+	// Secrets 各app-key的密钥,必填
+	Secrets *AppSecrets
+
+	// Nonces 已使用nonce的存储,默认为进程内存储
+	Nonces NonceStore
+
+	// ClockSkew 请求时间戳与服务器时间允许的偏差,默认5分钟
+	ClockSkew time.Duration
+}
+
+// SignatureWithConfig 校验请求签名,签名为HMAC-SHA256(secret, 规范请求)的base64编码,规范请求见CanonicalRequest.
+// 校验通过后app-key作为当前请求的认证主体,失败时返回metacode.Unauthorized.
+func SignatureWithConfig(config SignatureConfig) echo.MiddlewareFunc {
+	if config.Secrets == nil {
+		panic("signature secrets is required")
+	}
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	if config.Nonces == nil {
+		config.Nonces = NewMemoryNonceStore()
+	}
+	if config.ClockSkew == 0 {
+		config.ClockSkew = 5 * time.Minute
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+			req := c.Request()
+			appKey, nonce := req.Header.Get(HeaderAppKey), req.Header.Get(HeaderNonce)
+			ts, err := strconv.ParseInt(req.Header.Get(HeaderTimestamp), 10, 64)
+			if len(appKey) == 0 || len(nonce) == 0 || err != nil {
+				return metacode.Errorf(metacode.Unauthorized, "缺少签名参数")
+			}
+			if d := time.Since(time.Unix(ts, 0)); d > config.ClockSkew || d < -config.ClockSkew {
+				return metacode.Errorf(metacode.Unauthorized, "请求时间戳超出允许范围")
+			}
+			secret, ok := config.Secrets.Secret(appKey)
+			if !ok {
+				return metacode.Errorf(metacode.Unauthorized, "无效的app-key[%s]", appKey)
+			}
+			body, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				return err
+			}
+			req.Body = ioutil.NopCloser(bytes.NewReader(body))
+			sign, err := base64.StdEncoding.DecodeString(req.Header.Get(HeaderSignature))
+			if err != nil || !hmac.Equal(sign, signRequest(secret, CanonicalRequest(req, body))) {
+				return metacode.Errorf(metacode.Unauthorized, "签名错误")
+			}
+			// 时间戳窗口之外的请求已被拒绝,nonce只需保留两倍窗口时间
+			if ok, err = config.Nonces.Use(appKey+":"+nonce, 2*config.ClockSkew); err != nil {
+				return err
+			} else if !ok {
+				return metacode.Errorf(metacode.Unauthorized, "重复的请求")
+			}
+			SetSubject(c, appKey)
+			return next(c)
+		}
+	}
+}
+
+// CanonicalRequest 构造待签名的规范请求,各部分以换行分隔:
+//
+//	METHOD
+//	/path
+//	a=1&b=2 (按参数名及值排序并URL编码)
+//	app-key
+//	timestamp
+//	nonce
+//	hex(sha256(body))
+func CanonicalRequest(req *http.Request, body []byte) string {
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			pairs = append(pairs, url.QueryEscape(k)+"="+url.QueryEscape(v))
+		}
+	}
+	path := req.URL.EscapedPath()
+	if len(path) == 0 {
+		path = "/"
+	}
+	sum := sha256.Sum256(body)
+	return strings.Join([]string{
+		req.Method,
+		path,
+		strings.Join(pairs, "&"),
+		req.Header.Get(HeaderAppKey),
+		req.Header.Get(HeaderTimestamp),
+		req.Header.Get(HeaderNonce),
+		hex.EncodeToString(sum[:]),
+	}, "\n")
+}
+
+func signRequest(secret, canonical string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(canonical))
+	return mac.Sum(nil)
+}
+
+// Signer 客户端请求签名
+type Signer struct {
+	AppKey string
+	Secret string
+}
+
+// Sign 为请求设置app-key,时间戳,nonce及签名请求头,请求体会被读取后重新设置.
+func (s Signer) Sign(req *http.Request) error {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return err
+		}
+		_ = req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	req.Header.Set(HeaderAppKey, s.AppKey)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(time.Now().Unix(), 10))
+	req.Header.Set(HeaderNonce, hex.EncodeToString(nonce))
+	req.Header.Set(HeaderSignature, base64.StdEncoding.EncodeToString(signRequest(s.Secret, CanonicalRequest(req, body))))
+	return nil
+}
+
+// Transport 返回对每个请求签名后再交给base发送的http.RoundTripper,base为nil时使用http.DefaultTransport.
+func (s Signer) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return signerTransport{signer: s, base: base}
+}
+
+type signerTransport struct {
+	signer Signer
+	base   http.RoundTripper
+}
+
+func (t signerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTripper不应修改原请求
+	req = req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = body
+	}
+	if err := t.signer.Sign(req); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,78 @@
+package web_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aluka-7/web"
+	"github.com/labstack/echo/v4"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSignature(t *testing.T) {
+	Convey("test request signature\n", t, func() {
+		e := echo.New()
+		e.HTTPErrorHandler = web.HTTPErrorHandler
+		e.Use(web.SignatureWithConfig(web.SignatureConfig{
+			Secrets:   web.NewAppSecrets(map[string]string{"partner": "s3cret"}),
+			ClockSkew: time.Minute,
+		}))
+		e.POST("/orders", func(c echo.Context) error {
+			body, _ := ioutil.ReadAll(c.Request().Body)
+			return c.String(http.StatusOK, web.Subject(c)+":"+string(body))
+		})
+		newReq := func() *http.Request {
+			return httptest.NewRequest(http.MethodPost, "/orders?b=2&a=1&a=0", strings.NewReader(`{"id":1}`))
+		}
+		do := func(req *http.Request) *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			return rec
+		}
+		signer := web.Signer{AppKey: "partner", Secret: "s3cret"}
+
+		req := newReq()
+		So(signer.Sign(req), ShouldBeNil)
+		replay := req.Clone(req.Context())
+		rec := do(req)
+		So(rec.Code, ShouldEqual, http.StatusOK)
+		So(rec.Body.String(), ShouldEqual, `partner:{"id":1}`)
+
+		// 重放同一请求
+		replay.Body = ioutil.NopCloser(strings.NewReader(`{"id":1}`))
+		So(do(replay).Code, ShouldEqual, http.StatusUnauthorized)
+
+		// 篡改请求体
+		req = newReq()
+		So(signer.Sign(req), ShouldBeNil)
+		req.Body = ioutil.NopCloser(strings.NewReader(`{"id":2}`))
+		So(do(req).Code, ShouldEqual, http.StatusUnauthorized)
+
+		// 密钥错误
+		req = newReq()
+		So(web.Signer{AppKey: "partner", Secret: "wrong"}.Sign(req), ShouldBeNil)
+		So(do(req).Code, ShouldEqual, http.StatusUnauthorized)
+
+		// 时间戳超出窗口
+		req = newReq()
+		So(signer.Sign(req), ShouldBeNil)
+		req.Header.Set(web.HeaderTimestamp, strconv.FormatInt(time.Now().Add(-2*time.Minute).Unix(), 10))
+		So(do(req).Code, ShouldEqual, http.StatusUnauthorized)
+
+		// 通过Transport签名
+		srv := httptest.NewServer(e)
+		defer srv.Close()
+		client := &http.Client{Transport: signer.Transport(nil)}
+		resp, err := client.Post(srv.URL+"/orders?x=1", echo.MIMEApplicationJSON, strings.NewReader(`{"id":3}`))
+		So(err, ShouldBeNil)
+		body, _ := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		So(string(body), ShouldEqual, `partner:{"id":3}`)
+	})
+}
@@ -0,0 +1,140 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// SPAConfig 单页应用配置
+type SPAConfig struct {
+	// Skipper defines a function to skip middleware.
+	Skipper middleware.Skipper
+
+	// Assets 前端构建产物,Assets的访问路径前缀即单页应用的挂载路径,例如NewAssets(dist, "")
+	Assets *Assets
+
+	// Index 入口文件,默认"index.html"
+	Index string
+
+	// APIPrefixes 接口路径前缀,例如"/api/",这些路径不存在时返回404而不是入口文件
+	APIPrefixes []string
+
+	// HashedPrefixes 构建工具输出的带内容哈希的文件所在目录(相对于Assets),这些文件长期缓存,默认"assets/"及"static/"
+	HashedPrefixes []string
+
+	// APIBase 接口地址,注入到运行时配置中
+	APIBase string
+
+	// RuntimeConfig 注入到入口文件的其他运行时配置
+	RuntimeConfig map[string]interface{}
+
+	// ConfigVar 运行时配置在浏览器中的全局变量名,默认"__APP_CONFIG__"
+	ConfigVar string
+}
+
+// SPAWithConfig 单页应用中间件:存在的文件直接返回;其余GET请求在路由返回404且不属于接口路径时返回入口文件,
+// 由前端路由处理(history模式).入口文件的</head>前注入window[ConfigVar]={"PaPath":...,"APIBase":...},不缓存.
+// 与StaticWithConfig相同,需在全局压缩中间件之前注册.
+func SPAWithConfig(config SPAConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	if config.Assets == nil {
+		panic("spa middleware requires assets")
+	}
+	if len(config.Index) == 0 {
+		config.Index = "index.html"
+	}
+	if config.HashedPrefixes == nil {
+		config.HashedPrefixes = []string{"assets/", "static/"}
+	}
+	if len(config.ConfigVar) == 0 {
+		config.ConfigVar = "__APP_CONFIG__"
+	}
+	a := config.Assets
+	index, err := fs.ReadFile(a.fs, config.Index)
+	if err != nil {
+		panic(fmt.Errorf("读取单页应用入口文件[%s]出错:%w", config.Index, err))
+	}
+	runtime := map[string]interface{}{"PaPath": paPath(), "APIBase": config.APIBase}
+	for k, v := range config.RuntimeConfig {
+		runtime[k] = v
+	}
+	// json.Marshal会转义<,>及&,可以直接放在script中
+	js, err := json.Marshal(runtime)
+	if err != nil {
+		panic(fmt.Errorf("序列化单页应用运行时配置出错:%w", err))
+	}
+	name, _ := json.Marshal(config.ConfigVar)
+	script := "window[" + string(name) + "]=" + string(js) + ";</script>"
+	serveIndex := func(c echo.Context) error {
+		tag := "<script>"
+		if nonce := CSPNonce(c); len(nonce) > 0 {
+			tag = `<script nonce="` + nonce + `">`
+		}
+		c.Response().Header().Set("Cache-Control", "no-cache")
+		return c.HTMLBlob(http.StatusOK, injectHead(index, tag+script))
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if (req.Method != http.MethodGet && req.Method != http.MethodHead) || config.Skipper(c) {
+				return next(c)
+			}
+			p := req.URL.Path
+			if p != a.prefix && !strings.HasPrefix(p, a.prefix+"/") {
+				return next(c)
+			}
+			for _, api := range config.APIPrefixes {
+				if strings.HasPrefix(p, api) {
+					return next(c)
+				}
+			}
+			name := path.Clean(strings.TrimPrefix(strings.TrimPrefix(p, a.prefix), "/"))
+			// 根路径清理后为".",与入口文件同样处理
+			if name == "." || name == config.Index {
+				return serveIndex(c)
+			}
+			if f, ok := a.files[name]; ok {
+				hashed := f.immutable
+				for _, prefix := range config.HashedPrefixes {
+					hashed = hashed || strings.HasPrefix(name, prefix)
+				}
+				if hashed {
+					return a.serve(c, f, "public, max-age=31536000, immutable")
+				}
+				return a.serve(c, f, "no-cache")
+			}
+			err := next(c)
+			if he, ok := err.(*echo.HTTPError); ok && he.Code == http.StatusNotFound && acceptsHTML(req, name) {
+				return serveIndex(c)
+			}
+			return err
+		}
+	}
+}
+
+// 前端路由一般没有扩展名,带扩展名的路径只有浏览器导航时才返回入口文件,避免缺失的脚本返回HTML
+func acceptsHTML(req *http.Request, name string) bool {
+	return len(path.Ext(name)) == 0 || strings.Contains(req.Header.Get(echo.HeaderAccept), echo.MIMETextHTML)
+}
+
+// 插入到</head>之前,没有head时插入到开头
+func injectHead(html []byte, s string) []byte {
+	i := bytes.Index(bytes.ToLower(html), []byte("</head>"))
+	if i < 0 {
+		i = 0
+	}
+	b := make([]byte, 0, len(html)+len(s))
+	b = append(b, html[:i]...)
+	b = append(b, s...)
+	return append(b, html[i:]...)
+}
@@ -0,0 +1,85 @@
+package web_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/aluka-7/web"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSPA(t *testing.T) {
+	Convey("test SPA mode\n", t, func() {
+		os.Setenv("CI_PROJECT_NAMESPACE", "ops")
+		os.Setenv("CI_APP_NAME", "console")
+		defer os.Unsetenv("CI_PROJECT_NAMESPACE")
+		defer os.Unsetenv("CI_APP_NAME")
+		dist := fstest.MapFS{
+			"index.html":               {Data: []byte(`<html><head><title>app</title></head><body><div id="root"></div></body></html>`)},
+			"favicon.ico":              {Data: []byte("icon")},
+			"assets/index-3f2a1b9c.js": {Data: []byte("render()")},
+		}
+		assets, err := web.NewAssets(dist, "")
+		So(err, ShouldBeNil)
+
+		e := echo.New()
+		e.Use(web.SecureWithConfig(web.SecureConfig{ContentSecurityPolicy: "script-src {nonce}"}))
+		e.Use(web.SPAWithConfig(web.SPAConfig{
+			Assets:        assets,
+			APIPrefixes:   []string{"/api/"},
+			APIBase:       "/api",
+			RuntimeConfig: map[string]interface{}{"title": "</script>"},
+		}))
+		e.Use(middleware.Gzip())
+		e.GET("/api/users", func(c echo.Context) error {
+			return c.JSON(http.StatusOK, []string{"tom"})
+		})
+		e.GET("/healthy", func(c echo.Context) error {
+			return c.String(http.StatusOK, "Okey!")
+		})
+		do := func(target string, header ...string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, target, nil)
+			for i := 0; i < len(header); i += 2 {
+				req.Header.Set(header[i], header[i+1])
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			return rec
+		}
+
+		// 前端路由返回注入运行时配置的入口文件
+		for _, p := range []string{"/", "/index.html", "/users/42", "/users/tom.smith"} {
+			rec := do(p, "Accept", "text/html,application/xhtml+xml", "Accept-Encoding", "gzip")
+			So(rec.Code, ShouldEqual, http.StatusOK)
+			So(rec.Header().Get("Cache-Control"), ShouldEqual, "no-cache")
+			So(rec.Header().Get(echo.HeaderContentEncoding), ShouldBeEmpty)
+			body := rec.Body.String()
+			So(body, ShouldContainSubstring, `window["__APP_CONFIG__"]={"APIBase":"/api","PaPath":"/ops/console","title":"\u003c/script\u003e"};</script></head>`)
+			So(body, ShouldContainSubstring, `<script nonce="`)
+		}
+
+		// 根路径不依赖Accept头
+		rec := do("/")
+		So(rec.Code, ShouldEqual, http.StatusOK)
+		So(rec.Body.String(), ShouldContainSubstring, `<div id="root"></div>`)
+
+		// 接口路径及已注册的路由不回退
+		So(do("/api/users").Body.String(), ShouldContainSubstring, "tom")
+		So(do("/api/missing").Code, ShouldEqual, http.StatusNotFound)
+		So(do("/healthy").Body.String(), ShouldEqual, "Okey!")
+		So(do("/missing.js").Code, ShouldEqual, http.StatusNotFound)
+
+		// 带哈希的文件长期缓存,其余文件每次验证
+		rec = do("/assets/index-3f2a1b9c.js")
+		So(rec.Body.String(), ShouldEqual, "render()")
+		So(rec.Header().Get("Cache-Control"), ShouldEqual, "public, max-age=31536000, immutable")
+		rec = do("/favicon.ico")
+		So(rec.Body.String(), ShouldEqual, "icon")
+		So(rec.Header().Get("Cache-Control"), ShouldEqual, "no-cache")
+	})
+}
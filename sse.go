@@ -0,0 +1,251 @@
+package web
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const HeaderLastEventID = "Last-Event-ID"
+
+// SSEEvent 一条Server-Sent Events事件
+type SSEEvent struct {
+	ID    string        // 事件ID,客户端重连时通过Last-Event-ID带回
+	Event string        // 事件类型,为空时客户端触发message事件
+	Data  interface{}   // 事件数据,string和[]byte原样输出,其余类型编码为JSON
+	Retry time.Duration // 客户端重连间隔
+}
+
+// ReplayBuffer 事件回放缓冲区,客户端携带Last-Event-ID重连时补发之后的事件.
+type ReplayBuffer interface {
+	// Append 追加事件,ID为空时由缓冲区分配,返回实际保存的事件
+	Append(e SSEEvent) SSEEvent
+	// Since 返回指定ID之后的事件,ID已不在缓冲区时返回false
+	Since(id string) ([]SSEEvent, bool)
+}
+
+// NewMemoryReplayBuffer 创建保留最近size条事件的内存缓冲区
+func NewMemoryReplayBuffer(size int) ReplayBuffer {
+	return &memoryReplayBuffer{size: size}
+}
+
+type memoryReplayBuffer struct {
+	lock   sync.RWMutex
+	size   int
+	seq    uint64
+	events []SSEEvent
+}
+
+func (b *memoryReplayBuffer) Append(e SSEEvent) SSEEvent {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.seq++
+	if len(e.ID) == 0 {
+		e.ID = strconv.FormatUint(b.seq, 10)
+	}
+	b.events = append(b.events, e)
+	if len(b.events) > b.size {
+		b.events = b.events[len(b.events)-b.size:]
+	}
+	return e
+}
+
+func (b *memoryReplayBuffer) Since(id string) ([]SSEEvent, bool) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	for i := len(b.events) - 1; i >= 0; i-- {
+		if b.events[i].ID == id {
+			return append([]SSEEvent(nil), b.events[i+1:]...), true
+		}
+	}
+	return nil, false
+}
+
+// SSEConfig SSE配置
+type SSEConfig struct {
+	// Heartbeat 心跳间隔,默认15秒,小于0时不发送.心跳为注释行,可防止代理断开空闲连接
+	Heartbeat time.Duration
+
+	// Retry 建议客户端的重连间隔,为0时不设置
+	Retry time.Duration
+
+	// Replay 事件回放缓冲区,为nil时不支持断点续传
+	Replay ReplayBuffer
+}
+
+// ErrSSEClosed 客户端断开或服务关闭后继续发送事件时返回
+var ErrSSEClosed = errors.New("sse: stream closed")
+
+// ErrSSEInvalidField 事件ID或类型包含换行时返回,换行会被客户端当作新的字段或事件
+var ErrSSEInvalidField = errors.New("sse: id and event must not contain line breaks")
+
+// 客户端将\r\n,\r和\n都视为行结束
+var sseLineBreaks = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+// SSEStream Server-Sent Events输出流,可在多个goroutine中调用Send.
+type SSEStream struct {
+	lock   sync.Mutex
+	rw     ResponseWriter
+	done   chan struct{}
+	once   sync.Once
+	lastID string
+}
+
+// SSEHandler SSE处理函数,应当持续发送事件直到stream.Done()关闭,返回后流即结束.
+type SSEHandler func(c echo.Context, stream *SSEStream) error
+
+// SSE 输出SSE响应头,如果请求携带Last-Event-ID且配置了回放缓冲区则先补发错过的事件,再交给handler处理.
+// stream.Done()在客户端断开或服务关闭时关闭.
+func SSE(handler SSEHandler, config ...SSEConfig) echo.HandlerFunc {
+	var conf SSEConfig
+	if len(config) > 0 {
+		conf = config[0]
+	}
+	return func(c echo.Context) error {
+		stream, err := newSSEStream(c, conf)
+		if err != nil {
+			return err
+		}
+		defer stream.finish()
+		return handler(c, stream)
+	}
+}
+
+func newSSEStream(c echo.Context, config SSEConfig) (*SSEStream, error) {
+	if config.Heartbeat == 0 {
+		config.Heartbeat = 15 * time.Second
+	}
+	h := c.Response().Header()
+	h.Set(echo.HeaderContentType, "text/event-stream; charset=UTF-8")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	h.Set("X-Accel-Buffering", "no") // 关闭nginx缓冲
+	s := &SSEStream{
+		rw:     NewResponseWriter(c.Response()),
+		done:   make(chan struct{}),
+		lastID: c.Request().Header.Get(HeaderLastEventID),
+	}
+	s.rw.WriteHeader(http.StatusOK)
+	if config.Retry > 0 {
+		if err := s.write([]byte(fmt.Sprintf("retry: %d\n\n", config.Retry/time.Millisecond))); err != nil {
+			return nil, err
+		}
+	}
+	s.rw.Flush()
+	go s.watch(c.Request().Context().Done())
+	if config.Heartbeat > 0 {
+		go s.heartbeat(config.Heartbeat)
+	}
+	if config.Replay != nil && len(s.lastID) > 0 {
+		events, _ := config.Replay.Since(s.lastID)
+		for _, e := range events {
+			if err := s.Send(e); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return s, nil
+}
+
+// LastEventID 返回客户端重连时携带的Last-Event-ID
+func (s *SSEStream) LastEventID() string {
+	return s.lastID
+}
+
+// Done 客户端断开或服务关闭时关闭
+func (s *SSEStream) Done() <-chan struct{} {
+	return s.done
+}
+
+// Send 发送一条事件并立即刷新,ID或类型包含换行时返回ErrSSEInvalidField
+func (s *SSEStream) Send(e SSEEvent) error {
+	if strings.ContainsAny(e.ID, "\r\n") || strings.ContainsAny(e.Event, "\r\n") {
+		return ErrSSEInvalidField
+	}
+	buf := new(bytes.Buffer)
+	if len(e.ID) > 0 {
+		fmt.Fprintf(buf, "id: %s\n", e.ID)
+	}
+	if len(e.Event) > 0 {
+		fmt.Fprintf(buf, "event: %s\n", e.Event)
+	}
+	if e.Retry > 0 {
+		fmt.Fprintf(buf, "retry: %d\n", e.Retry/time.Millisecond)
+	}
+	var data []byte
+	switch v := e.Data.(type) {
+	case nil:
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		var err error
+		if data, err = (jsonCodec{}).Marshal(v); err != nil {
+			return err
+		}
+	}
+	for _, line := range strings.Split(sseLineBreaks.Replace(string(data)), "\n") {
+		fmt.Fprintf(buf, "data: %s\n", line)
+	}
+	buf.WriteByte('\n')
+	return s.write(buf.Bytes())
+}
+
+func (s *SSEStream) write(b []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	select {
+	case <-s.done:
+		return ErrSSEClosed
+	default:
+	}
+	if _, err := s.rw.Write(b); err != nil {
+		s.close()
+		return err
+	}
+	s.rw.Flush()
+	return nil
+}
+
+func (s *SSEStream) close() {
+	s.once.Do(func() { close(s.done) })
+}
+
+// 处理函数返回后结束流,加锁保证之后不会再有写入
+func (s *SSEStream) finish() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.close()
+}
+
+func (s *SSEStream) watch(clientGone <-chan struct{}) {
+	select {
+	case <-clientGone:
+	case <-shutdownCh:
+	case <-s.done:
+	}
+	s.close()
+}
+
+func (s *SSEStream) heartbeat(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.write([]byte(": ping\n\n")); err != nil {
+				return
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package web_test
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aluka-7/web"
+	"github.com/labstack/echo/v4"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSSE(t *testing.T) {
+	Convey("test SSE\n", t, func() {
+		replay := web.NewMemoryReplayBuffer(10)
+		for _, v := range []string{"a", "b", "c"} {
+			replay.Append(web.SSEEvent{Data: v})
+		}
+		e := echo.New()
+		e.GET("/events", web.SSE(func(c echo.Context, stream *web.SSEStream) error {
+			// 换行不能注入新的字段或事件
+			if err := stream.Send(web.SSEEvent{Event: "x\ndata: forged", Data: "a"}); err != web.ErrSSEInvalidField {
+				return err
+			}
+			if err := stream.Send(web.SSEEvent{ID: "9\r", Data: "a"}); err != web.ErrSSEInvalidField {
+				return err
+			}
+			if err := stream.Send(web.SSEEvent{Data: "x\revent: forged\r\ny"}); err != nil {
+				return err
+			}
+			return stream.Send(web.SSEEvent{Event: "done", Data: map[string]string{"last": stream.LastEventID()}})
+		}, web.SSEConfig{Replay: replay}))
+		s := httptest.NewServer(e)
+		defer s.Close()
+
+		req, _ := http.NewRequest(http.MethodGet, s.URL+"/events", nil)
+		req.Header.Set(web.HeaderLastEventID, "1")
+		resp, err := http.DefaultClient.Do(req)
+		So(err, ShouldBeNil)
+		defer resp.Body.Close()
+		So(resp.Header.Get(echo.HeaderContentType), ShouldStartWith, "text/event-stream")
+		var lines []string
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if line := scanner.Text(); len(line) > 0 {
+				lines = append(lines, line)
+			}
+		}
+		So(strings.Join(lines, "|"), ShouldEqual, `id: 2|data: b|id: 3|data: c|data: x|data: event: forged|data: y|event: done|data: {"last":"1"}`)
+	})
+}
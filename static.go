@@ -0,0 +1,246 @@
+package web
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// 预压缩文件的扩展名,按优先顺序
+var assetEncodings = []struct{ name, ext string }{{"br", ".br"}, {"gzip", ".gz"}}
+
+// Assets 静态资源,记录逻辑名称(如"js/app.js")到带内容指纹的名称(如"js/app.3f2a1b9c0d.js")的映射.
+type Assets struct {
+	fs       fs.FS
+	prefix   string
+	manifest map[string]string // 逻辑名称->指纹名称
+	files    map[string]*assetFile
+}
+
+type assetFile struct {
+	name      string // 文件系统中的名称
+	etag      string
+	immutable bool            // 带指纹的名称,内容不会变化
+	encodings map[string]bool // 存在的预压缩文件
+}
+
+// NewAssets 遍历fsys(可以是embed.FS,嵌入子目录时使用fs.Sub)计算每个文件的内容指纹,prefix为访问路径前缀,例如"/static".
+// 文件同时可通过逻辑名称及指纹名称访问,.br/.gz为对应文件的预压缩版本,不单独生成指纹.
+func NewAssets(fsys fs.FS, prefix string) (*Assets, error) {
+	return loadAssets(fsys, prefix, nil)
+}
+
+// NewAssetsWithManifest 使用构建工具生成的manifest文件(fsys中的JSON对象,逻辑名称到指纹名称)而不是计算指纹,
+// 指纹文件需已存在于fsys中.
+func NewAssetsWithManifest(fsys fs.FS, prefix, manifest string) (*Assets, error) {
+	b, err := fs.ReadFile(fsys, manifest)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]string)
+	if err = json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("解析静态资源manifest[%s]出错:%w", manifest, err)
+	}
+	return loadAssets(fsys, prefix, m)
+}
+
+func loadAssets(fsys fs.FS, prefix string, manifest map[string]string) (*Assets, error) {
+	a := &Assets{fs: fsys, prefix: strings.TrimSuffix(prefix, "/"), manifest: make(map[string]string), files: make(map[string]*assetFile)}
+	var names []string
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		names = append(names, name)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	exists := make(map[string]bool, len(names))
+	for _, name := range names {
+		exists[name] = true
+	}
+	for _, name := range names {
+		if ext := path.Ext(name); (ext == ".br" || ext == ".gz") && exists[strings.TrimSuffix(name, ext)] {
+			continue
+		}
+		b, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(b)
+		hash := hex.EncodeToString(sum[:5])
+		f := &assetFile{name: name, etag: `"` + hash + `"`, encodings: make(map[string]bool)}
+		for _, enc := range assetEncodings {
+			f.encodings[enc.name] = exists[name+enc.ext]
+		}
+		a.files[name] = f
+		if manifest == nil {
+			ext := path.Ext(name)
+			fingerprinted := strings.TrimSuffix(name, ext) + "." + hash + ext
+			a.manifest[name] = fingerprinted
+			a.files[fingerprinted] = &assetFile{name: name, etag: f.etag, immutable: true, encodings: f.encodings}
+		}
+	}
+	for logical, fingerprinted := range manifest {
+		f, ok := a.files[fingerprinted]
+		if !ok {
+			return nil, fmt.Errorf("静态资源manifest中的文件[%s]不存在", fingerprinted)
+		}
+		f.immutable = true
+		a.manifest[logical] = fingerprinted
+	}
+	return a, nil
+}
+
+// URL 返回逻辑名称对应的带指纹的访问路径,不在manifest中时返回未带指纹的路径
+func (a *Assets) URL(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	if f, ok := a.manifest[name]; ok {
+		name = f
+	}
+	return a.prefix + "/" + name
+}
+
+// Manifest 返回逻辑名称到指纹名称的映射
+func (a *Assets) Manifest() map[string]string {
+	m := make(map[string]string, len(a.manifest))
+	for k, v := range a.manifest {
+		m[k] = v
+	}
+	return m
+}
+
+// FuncMap 返回模板函数asset,例如{{asset "js/app.js"}},通过RenderOptions.Funcs注册
+func (a *Assets) FuncMap() template.FuncMap {
+	return template.FuncMap{"asset": a.URL}
+}
+
+// StaticConfig 静态资源中间件配置
+type StaticConfig struct {
+	// Skipper defines a function to skip middleware.
+	Skipper middleware.Skipper
+
+	// Assets 静态资源,必填
+	Assets *Assets
+
+	// MaxAge 未带指纹的文件的缓存时间,为0时每次使用前需重新验证(no-cache)
+	MaxAge time.Duration
+}
+
+// StaticWithConfig 静态资源中间件,带指纹的文件缓存一年并标记为immutable,
+// 客户端支持时返回预压缩的.br/.gz文件.中间件直接写出响应,需在全局压缩中间件之前注册(在WebApp中注册即可).
+func StaticWithConfig(config StaticConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+	if config.Assets == nil {
+		panic("static middleware requires assets")
+	}
+	a := config.Assets
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if (req.Method != http.MethodGet && req.Method != http.MethodHead) || config.Skipper(c) {
+				return next(c)
+			}
+			p := req.URL.Path
+			if !strings.HasPrefix(p, a.prefix+"/") {
+				return next(c)
+			}
+			f, ok := a.files[path.Clean(strings.TrimPrefix(p, a.prefix+"/"))]
+			if !ok {
+				return next(c)
+			}
+			return a.serve(c, f, assetCacheControl(f, config.MaxAge))
+		}
+	}
+}
+
+func assetCacheControl(f *assetFile, maxAge time.Duration) string {
+	switch {
+	case f.immutable:
+		return "public, max-age=31536000, immutable"
+	case maxAge > 0:
+		return "public, max-age=" + strconv.Itoa(int(maxAge/time.Second))
+	}
+	return "no-cache"
+}
+
+// 使用f.etag及预压缩文件写出文件内容,支持条件请求及Range
+func (a *Assets) serve(c echo.Context, f *assetFile, cacheControl string) error {
+	h := c.Response().Header()
+	name, etag := f.name, f.etag
+	if f.encodings["br"] || f.encodings["gzip"] {
+		h.Add(echo.HeaderVary, echo.HeaderAcceptEncoding)
+		accept := c.Request().Header.Get(echo.HeaderAcceptEncoding)
+		for _, enc := range assetEncodings {
+			if f.encodings[enc.name] && acceptsEncoding(accept, enc.name) {
+				typ := mime.TypeByExtension(path.Ext(f.name))
+				if len(typ) == 0 {
+					typ = echo.MIMEOctetStream
+				}
+				h.Set(echo.HeaderContentType, typ)
+				h.Set(echo.HeaderContentEncoding, enc.name)
+				name, etag = f.name+enc.ext, strings.TrimSuffix(etag, `"`)+"-"+enc.name+`"`
+				break
+			}
+		}
+	}
+	h.Set("ETag", etag)
+	h.Set("Cache-Control", cacheControl)
+	file, err := a.fs.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	fi, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	content, ok := file.(io.ReadSeeker)
+	if !ok {
+		b, err := io.ReadAll(file)
+		if err != nil {
+			return err
+		}
+		content = bytes.NewReader(b)
+	}
+	// 使用原文件名,确保预压缩文件按原扩展名推断类型
+	http.ServeContent(c.Response(), c.Request(), f.name, fi.ModTime(), content)
+	return nil
+}
+
+// 判断Accept-Encoding是否接受enc,忽略q=0的项
+func acceptsEncoding(accept, enc string) bool {
+	for _, v := range strings.Split(accept, ",") {
+		parts := strings.Split(v, ";")
+		if strings.TrimSpace(parts[0]) != enc {
+			continue
+		}
+		for _, p := range parts[1:] {
+			if q := strings.TrimSpace(p); strings.HasPrefix(q, "q=") {
+				if w, err := strconv.ParseFloat(q[2:], 64); err == nil && w == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
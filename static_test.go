@@ -0,0 +1,96 @@
+package web_test
+
+import (
+	"bytes"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/aluka-7/web"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStatic(t *testing.T) {
+	Convey("test Static assets\n", t, func() {
+		fsys := fstest.MapFS{
+			"js/app.js":          {Data: []byte("console.log('app')")},
+			"js/app.js.br":       {Data: []byte("br-data")},
+			"js/app.js.gz":       {Data: []byte("gz-data")},
+			"css/site.css":       {Data: []byte("body{}")},
+			"dist/app.1234.js":   {Data: []byte("built")},
+			"dist/manifest.json": {Data: []byte(`{"app.js":"app.1234.js"}`)},
+		}
+		assets, err := web.NewAssets(fsys, "/static/")
+		So(err, ShouldBeNil)
+		url := assets.URL("js/app.js")
+		So(url, ShouldStartWith, "/static/js/app.")
+		So(url, ShouldEndWith, ".js")
+		So(url, ShouldNotEqual, "/static/js/app.js")
+		So(assets.URL("/missing.png"), ShouldEqual, "/static/missing.png")
+		So(assets.Manifest()["css/site.css"], ShouldStartWith, "css/site.")
+
+		var b bytes.Buffer
+		tpl := template.Must(template.New("t").Funcs(assets.FuncMap()).Parse(`<script src="{{asset "js/app.js"}}"></script>`))
+		So(tpl.Execute(&b, nil), ShouldBeNil)
+		So(b.String(), ShouldEqual, `<script src="`+url+`"></script>`)
+
+		e := echo.New()
+		e.Use(web.StaticWithConfig(web.StaticConfig{Assets: assets, MaxAge: time.Hour}))
+		e.Use(middleware.Gzip())
+		e.GET("/static/dynamic", func(c echo.Context) error {
+			return c.String(http.StatusOK, "dynamic")
+		})
+		do := func(target string, header ...string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, target, nil)
+			for i := 0; i < len(header); i += 2 {
+				req.Header.Set(header[i], header[i+1])
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			return rec
+		}
+
+		// 指纹文件长期缓存,客户端支持时返回预压缩文件
+		rec := do(url, "Accept-Encoding", "gzip, br")
+		So(rec.Code, ShouldEqual, http.StatusOK)
+		So(rec.Header().Get("Cache-Control"), ShouldEqual, "public, max-age=31536000, immutable")
+		So(rec.Header().Get(echo.HeaderContentEncoding), ShouldEqual, "br")
+		So(rec.Header().Get(echo.HeaderContentType), ShouldStartWith, "text/javascript")
+		So(rec.Body.String(), ShouldEqual, "br-data")
+		So(rec.Header().Get("ETag"), ShouldEndWith, `-br"`)
+		rec = do(url, "Accept-Encoding", "gzip, br;q=0")
+		So(rec.Header().Get(echo.HeaderContentEncoding), ShouldEqual, "gzip")
+		So(rec.Body.String(), ShouldEqual, "gz-data")
+		rec = do(url)
+		So(rec.Header().Get(echo.HeaderContentEncoding), ShouldBeEmpty)
+		So(rec.Body.String(), ShouldEqual, "console.log('app')")
+		So(do(url, "If-None-Match", rec.Header().Get("ETag")).Code, ShouldEqual, http.StatusNotModified)
+
+		// 逻辑名称使用配置的缓存时间
+		rec = do("/static/css/site.css")
+		So(rec.Header().Get("Cache-Control"), ShouldEqual, "public, max-age=3600")
+		So(rec.Body.String(), ShouldEqual, "body{}")
+		So(do("/static/dynamic").Body.String(), ShouldEqual, "dynamic")
+		So(do("/static/../static/none.js").Code, ShouldEqual, http.StatusNotFound)
+
+		// 使用构建工具生成的manifest
+		sub, _ := web.NewAssetsWithManifest(mustSub(fsys, "dist"), "/assets", "manifest.json")
+		So(sub.URL("app.js"), ShouldEqual, "/assets/app.1234.js")
+		_, err = web.NewAssetsWithManifest(fstest.MapFS{"m.json": {Data: []byte(`{"a.js":"a.1.js"}`)}}, "/assets", "m.json")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func mustSub(fsys fstest.MapFS, dir string) fs.FS {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
@@ -0,0 +1,226 @@
+package web
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aluka-7/metacode"
+	"github.com/labstack/echo/v4"
+)
+
+// UploadStorage 上传文件的存储
+type UploadStorage interface {
+	// Save 保存文件内容,返回文件位置;读取r出错时必须清理已写入的内容
+	Save(filename string, r io.Reader) (location string, err error)
+	// Remove 删除已保存的文件,同一请求中后续文件出错时用于清理
+	Remove(location string) error
+}
+
+// UploadedFile 已保存的上传文件
+type UploadedFile struct {
+	Field       string `json:"field"`
+	Filename    string `json:"filename"`    // 客户端提供的文件名
+	ContentType string `json:"contentType"` // 根据内容检测的类型
+	Size        int64  `json:"size"`
+	Location    string `json:"location"` // 存储返回的位置
+}
+
+// UploadResult 上传表单的解析结果
+type UploadResult struct {
+	Files  []*UploadedFile
+	Values url.Values // 非文件字段
+}
+
+// UploadConfig 上传配置
+type UploadConfig struct {
+	// Storage 文件存储,必填
+	Storage UploadStorage
+
+	// MaxFileSize 单个文件的最大字节数,为0时不限制(仍受请求体大小限制)
+	MaxFileSize int64
+
+	// MaxFiles 最多文件数,为0时不限制
+	MaxFiles int
+
+	// AllowedTypes 允许的文件类型,根据文件内容检测,支持"image/*",为空时不限制
+	AllowedTypes []string
+
+	// MaxValueSize 非文件字段的总字节数,默认1MB
+	MaxValueSize int64
+
+	// Progress 每写入一块数据后回调,written为该文件已写入的字节数
+	Progress func(file *UploadedFile, written int64)
+}
+
+// Upload 以流的方式解析multipart/form-data请求,文件直接写入存储而不缓存在内存或临时目录中.
+// 任意文件出错时删除本次请求已保存的全部文件:超出大小返回413,类型不允许返回415.
+func Upload(c echo.Context, config UploadConfig) (*UploadResult, error) {
+	if config.Storage == nil {
+		return nil, errors.New("upload: storage is required")
+	}
+	if config.MaxValueSize == 0 {
+		config.MaxValueSize = 1 << 20
+	}
+	reader, err := c.Request().MultipartReader()
+	if err != nil {
+		return nil, metacode.Errorf(metacode.RequestErr, "解析上传请求出错[%s]", err)
+	}
+	result := &UploadResult{Values: make(url.Values)}
+	valueSize := int64(0)
+	fail := func(err error) (*UploadResult, error) {
+		for _, f := range result.Files {
+			if rerr := config.Storage.Remove(f.Location); rerr != nil {
+				c.Logger().Errorf("清理上传文件[%s]出错:%+v", f.Location, rerr)
+			}
+		}
+		// multipart包会包装读取错误(旧版本使用%v丢失错误链),请求体超出限制时统一返回413
+		if body, ok := c.Request().Body.(*limitedBody); ok && body.exceeded() {
+			return nil, echo.ErrStatusRequestEntityTooLarge
+		}
+		return nil, err
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			return fail(uploadError(err))
+		}
+		if len(part.FileName()) == 0 {
+			b, err := ioutil.ReadAll(io.LimitReader(part, config.MaxValueSize-valueSize+1))
+			if err != nil {
+				return fail(uploadError(err))
+			}
+			if valueSize += int64(len(b)); valueSize > config.MaxValueSize {
+				return fail(metacode.Errorf(metacode.IntCode(-http.StatusRequestEntityTooLarge), "表单字段超出大小限制"))
+			}
+			result.Values.Add(part.FormName(), string(b))
+			continue
+		}
+		if config.MaxFiles > 0 && len(result.Files) >= config.MaxFiles {
+			return fail(metacode.Errorf(metacode.IntCode(-http.StatusRequestEntityTooLarge), "上传文件数超出限制%d", config.MaxFiles))
+		}
+		file, err := config.save(part)
+		if err != nil {
+			return fail(err)
+		}
+		result.Files = append(result.Files, file)
+	}
+}
+
+func (config UploadConfig) save(part *multipart.Part) (*UploadedFile, error) {
+	file := &UploadedFile{Field: part.FormName(), Filename: filepath.Base(part.FileName())}
+	head := make([]byte, 512)
+	n, err := io.ReadFull(part, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, uploadError(err)
+	}
+	head = head[:n]
+	file.ContentType = http.DetectContentType(head)
+	if !allowedType(config.AllowedTypes, file.ContentType) {
+		return nil, metacode.Errorf(metacode.IntCode(-http.StatusUnsupportedMediaType), "不允许上传的文件类型[%s]", file.ContentType)
+	}
+	r := &uploadReader{Reader: io.MultiReader(bytes.NewReader(head), part), file: file, config: config}
+	if file.Location, err = config.Storage.Save(file.Filename, r); err != nil {
+		return nil, uploadError(err)
+	}
+	file.Size = r.written
+	return file, nil
+}
+
+// 统计写入字节数,检查大小限制并回调进度
+type uploadReader struct {
+	io.Reader
+	file    *UploadedFile
+	config  UploadConfig
+	written int64
+}
+
+var errUploadTooLarge = metacode.Errorf(metacode.IntCode(-http.StatusRequestEntityTooLarge), "上传文件超出大小限制")
+
+func (r *uploadReader) Read(b []byte) (int, error) {
+	n, err := r.Reader.Read(b)
+	r.written += int64(n)
+	if r.config.MaxFileSize > 0 && r.written > r.config.MaxFileSize {
+		return n, errUploadTooLarge
+	}
+	if n > 0 && r.config.Progress != nil {
+		r.config.Progress(r.file, r.written)
+	}
+	return n, err
+}
+
+func allowedType(allowed []string, contentType string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	for _, a := range allowed {
+		if a == mediaType || (strings.HasSuffix(a, "/*") && strings.HasPrefix(mediaType, a[:len(a)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+// 请求体超出限制等错误原样返回,其余视为请求错误
+func uploadError(err error) error {
+	if errors.Is(err, errUploadTooLarge) {
+		return errUploadTooLarge
+	}
+	if errors.Is(err, echo.ErrStatusRequestEntityTooLarge) {
+		return echo.ErrStatusRequestEntityTooLarge
+	}
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		return he
+	}
+	return metacode.Errorf(metacode.RequestErr, "读取上传文件出错[%s]", err)
+}
+
+// NewLocalUploadStorage 创建保存到本地目录的存储,文件先写入同目录下的临时文件,完成后重命名,
+// 文件名为随机串加原扩展名.
+func NewLocalUploadStorage(dir string) UploadStorage {
+	return localUploadStorage(dir)
+}
+
+type localUploadStorage string
+
+func (dir localUploadStorage) Save(filename string, r io.Reader) (string, error) {
+	if err := os.MkdirAll(string(dir), 0755); err != nil {
+		return "", err
+	}
+	tmp, err := ioutil.TempFile(string(dir), ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	if _, err = io.Copy(tmp, r); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return "", err
+	}
+	if err = tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return "", err
+	}
+	name := randomToken() + strings.ToLower(filepath.Ext(filename))
+	if err = os.Rename(tmp.Name(), filepath.Join(string(dir), name)); err != nil {
+		_ = os.Remove(tmp.Name())
+		return "", err
+	}
+	return name, nil
+}
+
+func (dir localUploadStorage) Remove(location string) error {
+	return os.Remove(filepath.Join(string(dir), filepath.Base(location)))
+}
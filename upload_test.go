@@ -0,0 +1,108 @@
+package web_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aluka-7/web"
+	"github.com/labstack/echo/v4"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n")
+
+func multipartBody(files map[string][]byte, values map[string]string) (*bytes.Buffer, string) {
+	body := new(bytes.Buffer)
+	w := multipart.NewWriter(body)
+	for k, v := range values {
+		_ = w.WriteField(k, v)
+	}
+	for name, data := range files {
+		fw, _ := w.CreateFormFile("file", name)
+		_, _ = fw.Write(data)
+	}
+	_ = w.Close()
+	return body, w.FormDataContentType()
+}
+
+func TestUpload(t *testing.T) {
+	Convey("test Upload and BodyLimit\n", t, func() {
+		dir, err := ioutil.TempDir("", "upload")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		var progress int64
+		e := echo.New()
+		e.HTTPErrorHandler = web.HTTPErrorHandler
+		e.Use(web.BodyLimitWithConfig(web.BodyLimitConfig{Limit: "1K", Routes: map[string]string{"POST /upload": "64K"}}))
+		upload := func(c echo.Context) error {
+			result, err := web.Upload(c, web.UploadConfig{
+				Storage:      web.NewLocalUploadStorage(dir),
+				MaxFileSize:  4 << 10,
+				AllowedTypes: []string{"image/*", "text/plain"},
+				Progress:     func(f *web.UploadedFile, written int64) { progress = written },
+			})
+			if err != nil {
+				return err
+			}
+			return c.JSON(http.StatusOK, result)
+		}
+		e.POST("/upload", upload)
+		web.Describe(e, e.POST("/small", upload)).BodyLimit("2K")
+		e.POST("/echo", func(c echo.Context) error {
+			b, err := ioutil.ReadAll(c.Request().Body)
+			if err != nil {
+				return err
+			}
+			return c.Blob(http.StatusOK, echo.MIMEOctetStream, b)
+		})
+		do := func(path string, body *bytes.Buffer, contentType string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPost, path, body)
+			req.Header.Set(echo.HeaderContentType, contentType)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			return rec
+		}
+		saved := func() []string {
+			files, _ := filepath.Glob(filepath.Join(dir, "*"))
+			hidden, _ := filepath.Glob(filepath.Join(dir, ".*"))
+			return append(files, hidden...)
+		}
+
+		// 全局限制
+		So(do("/echo", bytes.NewBufferString(strings.Repeat("a", 512)), echo.MIMETextPlain).Code, ShouldEqual, http.StatusOK)
+		So(do("/echo", bytes.NewBufferString(strings.Repeat("a", 2048)), echo.MIMETextPlain).Code, ShouldEqual, http.StatusRequestEntityTooLarge)
+
+		png := append(append([]byte(nil), pngHeader...), bytes.Repeat([]byte{1}, 2000)...)
+		body, ct := multipartBody(map[string][]byte{"a.PNG": png, "b.txt": []byte("hello")}, map[string]string{"title": "report"})
+		rec := do("/upload", body, ct)
+		So(rec.Code, ShouldEqual, http.StatusOK)
+		So(rec.Body.String(), ShouldContainSubstring, `"contentType":"image/png"`)
+		So(rec.Body.String(), ShouldContainSubstring, `"title":["report"]`)
+		So(len(saved()), ShouldEqual, 2)
+		So(progress, ShouldBeGreaterThan, 0)
+
+		// 路由声明的限制
+		body, ct = multipartBody(map[string][]byte{"a.png": png}, nil)
+		So(do("/small", body, ct).Code, ShouldEqual, http.StatusRequestEntityTooLarge)
+		// 在读取下一个分段的头部时超出限制
+		raw := bytes.NewBufferString("--B\r\nContent-Disposition: form-data; name=\"a\"\r\n\r\nx\r\n--B\r\nContent-Disposition: form-data; name=\"")
+		raw.WriteString(strings.Repeat("b", 4096) + "\"\r\n\r\ny\r\n--B--\r\n")
+		So(do("/small", raw, "multipart/form-data; boundary=B").Code, ShouldEqual, http.StatusRequestEntityTooLarge)
+
+		// 类型或大小不符合时清理本次已保存的文件
+		body, ct = multipartBody(map[string][]byte{"ok.txt": []byte("hello"), "x.bin": {0x7f, 'E', 'L', 'F', 2, 1, 1, 0, 0, 0}}, nil)
+		So(do("/upload", body, ct).Code, ShouldEqual, http.StatusUnsupportedMediaType)
+		So(len(saved()), ShouldEqual, 2)
+		body, ct = multipartBody(map[string][]byte{"big.txt": bytes.Repeat([]byte("a"), 5000)}, nil)
+		So(do("/upload", body, ct).Code, ShouldEqual, http.StatusRequestEntityTooLarge)
+		So(len(saved()), ShouldEqual, 2)
+	})
+}
@@ -3,9 +3,9 @@ package web
 import (
 	"context"
 	"fmt"
-	"github.com/aluka-7/metacode"
 	"github.com/go-playground/validator/v10"
 	"io"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -21,14 +21,30 @@ import (
 type WebApp func(eng *echo.Echo)
 
 type Config struct {
-	Addr      string      `json:"addr"`
-	Gzip      int         `json:"gzip"`      // gzip压缩等级
-	EnableLog bool        `json:"enableLog"` // 是否打开日记
-	Tag       []trace.Tag `json:"tag"`
+	Addr      string       `json:"addr"`
+	Gzip      int          `json:"gzip"`      // gzip压缩等级
+	EnableLog bool         `json:"enableLog"` // 是否打开日记
+	LogFormat string       `json:"logFormat"` // 访问日志格式,json(默认),logfmt或template(使用默认模板,同text)
+	Tag       []trace.Tag  `json:"tag"`
+	Routes    RoutesConfig `json:"routes"` // 路由表查询及启动打印
+	Doc       DocConfig    `json:"doc"`    // 接口文档
+
+	// BodyLimit 请求体大小限制
+	BodyLimit BodyLimitConfig `json:"bodyLimit"`
+
+	// TrustedProxies 受信任的代理IP或CIDR,只有来自这些地址的转发头及PROXY protocol头才会被采信
+	TrustedProxies []string `json:"trustedProxies"`
+	// ProxyHeader 受信任代理设置的转发头,Forwarded,X-Forwarded-For(默认)或X-Real-IP,只读取该头
+	ProxyHeader string `json:"proxyHeader"`
+	// ProxyProtocol 监听器是否支持PROXY protocol v1/v2
+	ProxyProtocol bool `json:"proxyProtocol"`
 }
 
 var SwagHandler echo.HandlerFunc
 
+// 服务关闭时关闭,用于结束SSE等长连接
+var shutdownCh = make(chan struct{})
+
 func init() {
 	fmt.Println("Loading Web Engine ver:1.0")
 }
@@ -38,7 +54,8 @@ func App(wa WebApp, systemId string, conf configuration.Configuration) {
 }
 
 type web struct {
-	server *echo.Echo
+	server     *echo.Echo
+	middleware []string // 全局中间件名称,按注册顺序
 }
 
 func OptApp(wa WebApp, systemId string, conf configuration.Configuration) *web {
@@ -49,20 +66,49 @@ func OptApp(wa WebApp, systemId string, conf configuration.Configuration) *web {
 	}
 	w.server.HideBanner = true
 	w.server.Validator = formValidator
+	w.server.Binder = &Binder{}
+	w.server.HTTPErrorHandler = HTTPErrorHandler
+	w.server.IPExtractor = TrustedProxyIPExtractor(config.TrustedProxies, config.ProxyHeader)
 	if len(config.Tag) > 0 {
 		zipkin.Init(systemId, conf, config.Tag)
 	}
-	w.server.Use(middleware.Recover(), Trace(), LoggerWithConfig(systemId, config.EnableLog, DefaultLoggerConfig))
+	logConfig := DefaultLoggerConfig
+	// 默认使用json:默认模板不转义标签值,uri及user_agent等包含引号时输出的不是合法的JSON;template/text保留模板输出
+	switch config.LogFormat {
+	case "":
+		logConfig.Encoder = "json"
+	case "template", "text":
+		logConfig.Encoder = ""
+	default:
+		logConfig.Encoder = config.LogFormat
+	}
+	// RecoverWithConfig在Trace及Logger之内,panic作为错误记录到链路,访问日志及指标中;
+	// 最外层的middleware.Recover兜底Trace及Logger自身的panic
+	w.use(middleware.Recover(), Trace(), LoggerWithConfig(systemId, config.EnableLog, logConfig), RecoverWithConfig(RecoverConfig{}))
+	// 始终注册,未配置限制时由路由通过Describe声明的bodyLimit生效
+	w.use(BodyLimitWithConfig(config.BodyLimit))
 	// 为请求生成唯一id
 	// Dependency Injection & Route Register
 	wa(w.server)
 	w.server.GET("/healthy", func(c echo.Context) error {
 		return c.JSON(http.StatusOK, "Okey!")
 	})
+	if config.Doc.Enable {
+		RegisterDoc(w.server, config.Doc, openAPIInfo(systemId, config.Doc), nil)
+	}
 	if SwagHandler != nil {
-		w.server.GET("/doc/*", SwagHandler)
-	} else {
-		w.server.Use(middleware.Gzip())
+		w.server.GET("/doc/*", SwagHandler).Name = docRouteName
+	}
+	isDoc := docRouteSkipper(config.Doc, SwagHandler != nil)
+	w.use(middleware.GzipWithConfig(middleware.GzipConfig{Level: config.Gzip, Skipper: func(c echo.Context) bool {
+		// 范围请求的偏移基于未压缩的内容,压缩后将无法续传;接口文档自行处理压缩
+		return len(c.Request().Header.Get("Range")) > 0 || isDoc(c)
+	}}))
+	if len(config.Routes.Path) > 0 {
+		w.server.GET(config.Routes.Path, RoutesHandler(w.Middleware))
+	}
+	if config.Routes.Dump {
+		_ = w.Routes().WriteTable(os.Stdout)
 	}
 	go metrics()
 	w.start(config)
@@ -71,7 +117,25 @@ func OptApp(wa WebApp, systemId string, conf configuration.Configuration) *web {
 
 func newWeb() *web {
 	server := echo.New()
-	return &web{server}
+	return &web{server: server}
+}
+
+// 注册全局中间件并记录其名称,用于路由表展示
+func (w *web) use(m ...echo.MiddlewareFunc) {
+	for _, f := range m {
+		w.middleware = append(w.middleware, funcName(f))
+	}
+	w.server.Use(m...)
+}
+
+// Middleware 返回全局中间件名称
+func (w *web) Middleware() []string {
+	return w.middleware
+}
+
+// Routes 返回当前已注册的路由表
+func (w *web) Routes() RouteTable {
+	return InspectRoutes(w.server, w.middleware)
 }
 func (w *web) start(config Config) {
 	go func() {
@@ -79,13 +143,21 @@ func (w *web) start(config Config) {
 		if len(webPort) == 0 {
 			webPort = config.Addr
 		}
+		if config.ProxyProtocol {
+			l, err := net.Listen("tcp", webPort)
+			if err != nil {
+				fmt.Printf("Echo Engine Listen has error:%+v\n", err)
+				return
+			}
+			w.server.Listener = ProxyProtocolListener(l, config.TrustedProxies)
+		}
 		if err := w.server.Start(webPort); err != nil {
 			fmt.Println("Echo Engine Start has error")
 		}
 	}()
 }
 func (w *web) Close(close func()) {
-	quit := make(chan os.Signal)
+	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt)
 	<-quit
 	close()
@@ -95,6 +167,9 @@ func (w *web) shutdown() {
 	fmt.Println("Web Engine Shutdown Server ...")
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
+	// 通知SSE等长连接结束;echo不会关闭已劫持的WebSocket连接,需要先发送关闭帧
+	close(shutdownCh)
+	closeWebSockets(ctx)
 	if err := w.server.Shutdown(ctx); err != nil {
 		fmt.Println("Web Engine Shutdown has error")
 	} else {
@@ -113,7 +188,7 @@ func (e echoValidator) Validate(i interface{}) error {
 	if err == nil {
 		return nil
 	}
-	return metacode.Errorf(-1, "validator error[%s]", err)
+	return validateError(err)
 }
 
 // RegisterValidation 将验证功能添加到由键表示的验证者的验证者映射中
@@ -123,6 +198,16 @@ func RegisterValidation(key string, fn validator.Func) error {
 	return formValidator.validator.RegisterValidation(key, fn)
 }
 
+// 应用部署在网关下的路径前缀,由CI_PROJECT_NAMESPACE及CI_APP_NAME环境变量组成
+func paPath() string {
+	ns := os.Getenv("CI_PROJECT_NAMESPACE")
+	an := os.Getenv("CI_APP_NAME")
+	if len(ns) > 0 && len(an) > 0 {
+		return "/" + ns + "/" + an
+	}
+	return ""
+}
+
 func NewWebAppTemplate(opt RenderOptions, tplSets ...string) *webAppTemplate {
 	ts, op, cs := renderHandler(prepareRenderOptions([]RenderOptions{opt}), tplSets)
 	return &webAppTemplate{ts, op, cs}
@@ -139,13 +224,12 @@ func (f webAppTemplate) Render(writer io.Writer, s string, data interface{}, ctx
 	// Add global methods if data is a map
 	if viewContext, isMap := data.(map[string]interface{}); isMap {
 		viewContext["reverse"] = ctx.Echo().Reverse
-		ns := os.Getenv("CI_PROJECT_NAMESPACE")
-		an := os.Getenv("CI_APP_NAME")
-		PaPath := ""
-		if len(ns) > 0 && len(an) > 0 {
-			PaPath = "/" + ns + "/" + an
+		viewContext["PaPath"] = paPath()
+		if sess := Session(ctx); sess != nil {
+			viewContext["Session"] = sess.Values()
 		}
-		viewContext["PaPath"] = PaPath
+		viewContext["Flash"] = Flashes(ctx)
+		viewContext["CSPNonce"] = CSPNonce(ctx)
 		viewContext["TmplLoadTimes"] = func() string {
 			if r.startTime.IsZero() {
 				return ""
@@ -2,8 +2,10 @@ package web_test
 
 import (
 	"io/ioutil"
+	"net"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/aluka-7/configuration"
 	"github.com/aluka-7/configuration/backends"
@@ -22,8 +24,20 @@ func startServer(t *testing.T) {
 	}}))
 }
 
+// 等待服务监听端口就绪
+func waitServer(addr string) {
+	for i := 0; i < 50; i++ {
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
 func TestApp(t *testing.T) {
 	go startServer(t)
+	waitServer("localhost:9999")
 	client := &http.Client{}
 	Convey("test App\n", t, func() {
 		req, err := http.NewRequest("GET", "http://localhost:9999/none/api", nil)
@@ -0,0 +1,279 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aluka-7/metric"
+	"github.com/aluka-7/trace"
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	_metricWSConnActive = metric.NewGaugeVec(&metric.GaugeVecOpts{
+		Namespace: serverNamespace,
+		Subsystem: "websocket",
+		Name:      "connections_active",
+		Help:      "http server websocket active connections.",
+		Labels:    []string{"path"},
+	})
+	_metricWSMessages = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: serverNamespace,
+		Subsystem: "websocket",
+		Name:      "messages_total",
+		Help:      "http server websocket messages count.",
+		Labels:    []string{"path", "direction"},
+	})
+	_metricWSBytes = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: serverNamespace,
+		Subsystem: "websocket",
+		Name:      "bytes_total",
+		Help:      "http server websocket message bytes.",
+		Labels:    []string{"path", "direction"},
+	})
+	_metricWSClose = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: serverNamespace,
+		Subsystem: "websocket",
+		Name:      "close_total",
+		Help:      "http server websocket close code count.",
+		Labels:    []string{"path", "code"},
+	})
+)
+
+// WebSocketConfig WebSocket连接配置
+type WebSocketConfig struct {
+	// Upgrader 协议升级配置,默认不校验Origin以外的选项
+	Upgrader websocket.Upgrader
+
+	// PingInterval 发送ping的间隔,默认30秒,小于0时不发送
+	PingInterval time.Duration
+
+	// PongWait 等待pong(或任意消息)的超时时间,默认为PingInterval的两倍
+	PongWait time.Duration
+
+	// WriteWait 写消息的超时时间,默认10秒
+	WriteWait time.Duration
+
+	// MaxMessageSize 读取消息的最大字节数,默认不限制
+	MaxMessageSize int64
+}
+
+// DefaultWebSocketConfig is the default WebSocket config.
+var DefaultWebSocketConfig = WebSocketConfig{
+	PingInterval: 30 * time.Second,
+	WriteWait:    10 * time.Second,
+}
+
+// WSHandler WebSocket连接处理函数,返回后连接会被关闭:返回nil时关闭码为1000,否则为1011.
+type WSHandler func(c echo.Context, conn *WSConn) error
+
+// WSConn 对websocket.Conn的包装,统计收发消息并在写消息时加锁,可在多个goroutine中写.
+type WSConn struct {
+	conn      *websocket.Conn
+	ctx       context.Context
+	path      string
+	writeWait time.Duration
+	writeMu   sync.Mutex
+
+	messagesIn, messagesOut int64
+	bytesIn, bytesOut       int64
+	closeCode               int32
+}
+
+// 当前活跃的连接,用于服务关闭时发送关闭帧
+var wsConns = struct {
+	sync.Mutex
+	m  map[*WSConn]struct{}
+	wg sync.WaitGroup
+}{m: make(map[*WSConn]struct{})}
+
+// WebSocket 将请求升级为WebSocket连接并交给handler处理,连接在handler中处理完毕,
+// 因此Trace的跟踪和访问日志会覆盖整个连接周期.
+func WebSocket(handler WSHandler, config ...WebSocketConfig) echo.HandlerFunc {
+	conf := DefaultWebSocketConfig
+	if len(config) > 0 {
+		conf = config[0]
+	}
+	if conf.PingInterval == 0 {
+		conf.PingInterval = DefaultWebSocketConfig.PingInterval
+	}
+	if conf.PongWait == 0 && conf.PingInterval > 0 {
+		conf.PongWait = 2 * conf.PingInterval
+	}
+	if conf.WriteWait == 0 {
+		conf.WriteWait = DefaultWebSocketConfig.WriteWait
+	}
+	return func(c echo.Context) error {
+		ws, err := conf.Upgrader.Upgrade(c.Response(), c.Request(), nil)
+		if err != nil {
+			// Upgrader已经输出了错误响应
+			return err
+		}
+		c.Response().Status = http.StatusSwitchingProtocols
+		conn := &WSConn{conn: ws, ctx: c.Request().Context(), path: c.Path(), writeWait: conf.WriteWait}
+		if conf.MaxMessageSize > 0 {
+			ws.SetReadLimit(conf.MaxMessageSize)
+		}
+		if conf.PongWait > 0 {
+			_ = ws.SetReadDeadline(time.Now().Add(conf.PongWait))
+			ws.SetPongHandler(func(string) error {
+				return ws.SetReadDeadline(time.Now().Add(conf.PongWait))
+			})
+		}
+		conn.register()
+		_metricWSConnActive.Inc(conn.path)
+		stop := make(chan struct{})
+		if conf.PingInterval > 0 {
+			go conn.keepalive(conf.PingInterval, stop)
+		}
+
+		err = handler(c, conn)
+
+		close(stop)
+		code := websocket.CloseNormalClosure
+		if err != nil {
+			code = websocket.CloseInternalServerErr
+		}
+		conn.Close(code, "")
+		_ = ws.Close()
+		conn.unregister()
+		_metricWSConnActive.Add(-1, conn.path)
+		_metricWSClose.Inc(conn.path, strconv.Itoa(int(atomic.LoadInt32(&conn.closeCode))))
+
+		// 以连接的实际流量作为访问日志中的bytes_out
+		c.Response().Size += atomic.LoadInt64(&conn.bytesOut)
+		if t, ok := trace.FromContext(conn.ctx); ok {
+			t.SetTag(trace.Int("websocket.messages.in", int(atomic.LoadInt64(&conn.messagesIn))))
+			t.SetTag(trace.Int("websocket.messages.out", int(atomic.LoadInt64(&conn.messagesOut))))
+			t.SetTag(trace.Int("websocket.close_code", int(atomic.LoadInt32(&conn.closeCode))))
+			if err != nil {
+				t.SetTag(trace.Bool(trace.TagError, true))
+			}
+		}
+		return err
+	}
+}
+
+// Context 返回握手请求的上下文,其中包含Trace中间件创建的跟踪.
+func (c *WSConn) Context() context.Context {
+	return c.ctx
+}
+
+// Conn 返回底层连接,通过底层连接收发的消息不会计入指标.
+func (c *WSConn) Conn() *websocket.Conn {
+	return c.conn
+}
+
+// ReadMessage 读取一条消息,对端关闭连接时记录关闭码.
+func (c *WSConn) ReadMessage() (messageType int, p []byte, err error) {
+	messageType, p, err = c.conn.ReadMessage()
+	if err != nil {
+		code := websocket.CloseAbnormalClosure
+		var ce *websocket.CloseError
+		if errors.As(err, &ce) {
+			code = ce.Code
+		}
+		atomic.CompareAndSwapInt32(&c.closeCode, 0, int32(code))
+		return
+	}
+	atomic.AddInt64(&c.messagesIn, 1)
+	atomic.AddInt64(&c.bytesIn, int64(len(p)))
+	_metricWSMessages.Inc(c.path, "in")
+	_metricWSBytes.Add(float64(len(p)), c.path, "in")
+	return
+}
+
+// WriteMessage 写一条消息.
+func (c *WSConn) WriteMessage(messageType int, data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_ = c.conn.SetWriteDeadline(time.Now().Add(c.writeWait))
+	if err := c.conn.WriteMessage(messageType, data); err != nil {
+		return err
+	}
+	atomic.AddInt64(&c.messagesOut, 1)
+	atomic.AddInt64(&c.bytesOut, int64(len(data)))
+	_metricWSMessages.Inc(c.path, "out")
+	_metricWSBytes.Add(float64(len(data)), c.path, "out")
+	return nil
+}
+
+// ReadJSON 读取一条JSON消息.
+func (c *WSConn) ReadJSON(v interface{}) error {
+	_, p, err := c.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return jsonCodec{}.Unmarshal(p, v)
+}
+
+// WriteJSON 写一条JSON消息.
+func (c *WSConn) WriteJSON(v interface{}) error {
+	p, err := jsonCodec{}.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(websocket.TextMessage, p)
+}
+
+// Close 发送关闭帧,多次调用时仅记录第一次的关闭码.
+func (c *WSConn) Close(code int, text string) {
+	atomic.CompareAndSwapInt32(&c.closeCode, 0, int32(code))
+	msg := websocket.FormatCloseMessage(code, text)
+	_ = c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(c.writeWait))
+}
+
+func (c *WSConn) keepalive(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(c.writeWait)); err != nil {
+				return
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (c *WSConn) register() {
+	wsConns.Lock()
+	defer wsConns.Unlock()
+	wsConns.m[c] = struct{}{}
+	wsConns.wg.Add(1)
+}
+
+func (c *WSConn) unregister() {
+	wsConns.Lock()
+	defer wsConns.Unlock()
+	if _, ok := wsConns.m[c]; ok {
+		delete(wsConns.m, c)
+		wsConns.wg.Done()
+	}
+}
+
+// 向所有活跃连接发送1001关闭帧,并等待连接处理结束或超时.
+func closeWebSockets(ctx context.Context) {
+	wsConns.Lock()
+	for c := range wsConns.m {
+		c.Close(websocket.CloseGoingAway, "server shutdown")
+	}
+	wsConns.Unlock()
+	done := make(chan struct{})
+	go func() {
+		wsConns.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
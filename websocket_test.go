@@ -0,0 +1,45 @@
+package web_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aluka-7/web"
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWebSocket(t *testing.T) {
+	Convey("test WebSocket\n", t, func() {
+		e := echo.New()
+		e.Use(web.Trace())
+		e.GET("/ws", web.WebSocket(func(c echo.Context, conn *web.WSConn) error {
+			for {
+				mt, p, err := conn.ReadMessage()
+				if err != nil {
+					return nil
+				}
+				if err = conn.WriteMessage(mt, p); err != nil {
+					return err
+				}
+			}
+		}))
+		s := httptest.NewServer(e)
+		defer s.Close()
+
+		ws, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http")+"/ws", nil)
+		So(err, ShouldBeNil)
+		So(resp.StatusCode, ShouldEqual, http.StatusSwitchingProtocols)
+		So(ws.WriteMessage(websocket.TextMessage, []byte("hello")), ShouldBeNil)
+		_, p, err := ws.ReadMessage()
+		So(err, ShouldBeNil)
+		So(string(p), ShouldEqual, "hello")
+		So(ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")), ShouldBeNil)
+		_, _, err = ws.ReadMessage()
+		So(websocket.IsCloseError(err, websocket.CloseNormalClosure), ShouldBeTrue)
+		ws.Close()
+	})
+}